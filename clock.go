@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+	"github.com/mrWinston/granite.nvim/pkg/textedit"
+	"github.com/neovim/go-client/nvim"
+)
+
+// ClockReportArgs select the clocks of a ClockReport
+type ClockReportArgs struct {
+	// From and To limit the report to clocks started in this range of dates,
+	// both ends included
+	From string `json:"from,omitempty" yaml:"from,omitempty"`
+	To   string `json:"to,omitempty" yaml:"to,omitempty"`
+	// Tag limits the report to todos with a tag matching this pattern, see
+	// tagquery.ParsePattern
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty"`
+}
+
+// ClockReport sums up tracked time. A todo with several tags counts for each
+// of them, so the tag sums can add up to more than the total. Subtasks count
+// for their own tags and those of the todos they are nested in.
+type ClockReport struct {
+	TotalSeconds int64 `json:"total_seconds"`
+	// Tags holds the tracked time per tag
+	Tags map[string]int64 `json:"tags"`
+	// Folders holds the tracked time per folder of the notes, relative to
+	// the vault root
+	Folders map[string]int64 `json:"folders"`
+	// Dates holds the tracked time per day the clocks started on
+	Dates map[string]int64 `json:"dates"`
+}
+
+// ClockIn starts a clock on the todo referenced by args[0], a json encoded
+// TodoRef, by adding a running CLOCK: entry below its first line. Clocks
+// running on other todos are stopped first. Returns the start time.
+func (g *Granite) ClockIn(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called ClockIn with args: %v", args)
+	if len(args) != 1 {
+		g.logger.Errorf("ClockIn expects exactly 1 argument.")
+		return "", fmt.Errorf("ClockIn expects exactly 1 argument.")
+	}
+	ref, err := parseTodoRef(args[0])
+	if err != nil {
+		g.logger.Errorf("Cannot parse todo reference: %v", err)
+		return "", fmt.Errorf("Cannot parse todo reference: %w", err)
+	}
+	_, todo, err := g.ResolveTodo(v, ref)
+	if err != nil {
+		g.logger.Errorf("Cannot find todo: %v", err)
+		return "", fmt.Errorf("Cannot find todo: %w", err)
+	}
+	if _, running := todo.RunningClock(); running {
+		g.logger.Errorf("Todo %s is clocked in already", todo.ID)
+		return "", fmt.Errorf("Todo %s is clocked in already", todo.ID)
+	}
+
+	now := time.Now()
+	_, err = g.stopClocks(v, now)
+	if err != nil {
+		g.logger.Errorf("Cannot stop running clocks: %v", err)
+		return "", fmt.Errorf("Cannot stop running clocks: %w", err)
+	}
+
+	// stopping clocks can change the note, so the todo is looked up again
+	src, todo, err := g.ResolveTodo(v, &TodoRef{ID: todo.ID, FilePath: todo.FilePath})
+	if err != nil {
+		g.logger.Errorf("Cannot find todo: %v", err)
+		return "", fmt.Errorf("Cannot find todo: %w", err)
+	}
+	indent := []rune{}
+	for _, r := range todo.RawLine[:todo.MarkerRange.StartCol] {
+		if r != '\t' {
+			r = ' '
+		}
+		indent = append(indent, r)
+	}
+	row := todo.LineNumber - 1
+	lines := strings.Split(string(src.Content), "\n")
+	err = g.WriteEdits(v, src, []textedit.Edit{
+		textedit.Insert(row, len(lines[row]), "", string(indent)+models.FormatClock(now, time.Time{})),
+	})
+	if err != nil {
+		g.logger.Errorf("Cannot write clock: %v", err)
+		return "", fmt.Errorf("Cannot write clock: %w", err)
+	}
+	return now.Format(models.CLOCK_TIME_FORMAT), nil
+}
+
+// ClockOut stops the running clock of the todo referenced by args[0], a json
+// encoded TodoRef. Without arguments all running clocks are stopped. Returns
+// the number of seconds tracked by the stopped clocks.
+func (g *Granite) ClockOut(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called ClockOut with args: %v", args)
+	if len(args) > 1 {
+		g.logger.Errorf("ClockOut expects at most 1 argument.")
+		return "", fmt.Errorf("ClockOut expects at most 1 argument.")
+	}
+
+	now := time.Now()
+	if len(args) == 0 || args[0] == "" || args[0] == "{}" {
+		seconds, err := g.stopClocks(v, now)
+		if err != nil {
+			g.logger.Errorf("Cannot stop running clocks: %v", err)
+			return "", fmt.Errorf("Cannot stop running clocks: %w", err)
+		}
+		return strconv.FormatInt(seconds, 10), nil
+	}
+
+	ref, err := parseTodoRef(args[0])
+	if err != nil {
+		g.logger.Errorf("Cannot parse todo reference: %v", err)
+		return "", fmt.Errorf("Cannot parse todo reference: %w", err)
+	}
+	src, todo, err := g.ResolveTodo(v, ref)
+	if err != nil {
+		g.logger.Errorf("Cannot find todo: %v", err)
+		return "", fmt.Errorf("Cannot find todo: %w", err)
+	}
+	clock, running := todo.RunningClock()
+	if !running {
+		g.logger.Errorf("Todo %s is not clocked in", todo.ID)
+		return "", fmt.Errorf("Todo %s is not clocked in", todo.ID)
+	}
+	err = g.WriteEdits(v, src, []textedit.Edit{clockOutEdit(src, clock, now)})
+	if err != nil {
+		g.logger.Errorf("Cannot write clock: %v", err)
+		return "", fmt.Errorf("Cannot write clock: %w", err)
+	}
+	return strconv.FormatInt(clock.SecondsAt(now), 10), nil
+}
+
+// ClockReport sums up the tracked time of all todos per tag, folder and day.
+// args[0] are json encoded ClockReportArgs. Running clocks count until now.
+func (g *Granite) ClockReport(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called ClockReport with args: %v", args)
+	reportArgs := &ClockReportArgs{}
+	if len(args) > 0 && args[0] != "" {
+		err := json.Unmarshal([]byte(args[0]), reportArgs)
+		if err != nil {
+			g.logger.Errorf("Cannot parse report arguments: %v", err)
+			return "", fmt.Errorf("Cannot parse report arguments: %w", err)
+		}
+	}
+	for _, date := range []string{reportArgs.From, reportArgs.To} {
+		if _, err := time.Parse(DEFAULT_DATE_FORMAT, date); date != "" && err != nil {
+			g.logger.Errorf("Cannot parse report date '%s' : %v", date, err)
+			return "", fmt.Errorf("Cannot parse report date '%s' : %w", date, err)
+		}
+	}
+
+	pattern, err := g.parseTagFilter(reportArgs.Tag)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, done := g.supersede("ClockReport")
+	defer done()
+	todos, err := g.GetCurrentTodos(ctx, v)
+	if err != nil {
+		g.logger.Errorf("Error getting todos from markdown files: %v", err)
+		return "", fmt.Errorf("Error getting todos from markdown files: %w", err)
+	}
+
+	now := time.Now()
+	report := &ClockReport{
+		Tags:    map[string]int64{},
+		Folders: map[string]int64{},
+		Dates:   map[string]int64{},
+	}
+	for _, todo := range todos {
+		// clocks on subtasks count for the tags of their parents
+		tags := todo.InheritedTags()
+		if pattern != nil && !pattern.MatchAny(tags) {
+			continue
+		}
+		folder, err := filepath.Rel(g.RootPath, filepath.Dir(todo.FilePath))
+		if err != nil {
+			folder = filepath.Dir(todo.FilePath)
+		}
+		for _, clock := range todo.Clocks {
+			// dates are YYYY-MM-DD, so they compare as strings
+			date := clock.StartTime().Format(DEFAULT_DATE_FORMAT)
+			if (reportArgs.From != "" && date < reportArgs.From) || (reportArgs.To != "" && date > reportArgs.To) {
+				continue
+			}
+			seconds := clock.SecondsAt(now)
+			report.TotalSeconds += seconds
+			report.Folders[folder] += seconds
+			report.Dates[date] += seconds
+			for _, tag := range tags {
+				report.Tags[tag] += seconds
+			}
+		}
+	}
+
+	rawJson, err := json.Marshal(report)
+	return string(rawJson), err
+}
+
+// stopClocks stops all running clocks in the vault and returns the seconds
+// they tracked
+func (g *Granite) stopClocks(v *nvim.Nvim, now time.Time) (int64, error) {
+	todos, err := g.GetCurrentTodos(context.Background(), v)
+	if err != nil {
+		return 0, err
+	}
+
+	var seconds int64
+	for _, running := range todos {
+		if _, ok := running.RunningClock(); !ok {
+			continue
+		}
+		src, todo, err := g.ResolveTodo(v, &TodoRef{ID: running.ID, FilePath: running.FilePath})
+		if err != nil {
+			return seconds, err
+		}
+		clock, ok := todo.RunningClock()
+		if !ok {
+			continue
+		}
+		err = g.WriteEdits(v, src, []textedit.Edit{clockOutEdit(src, clock, now)})
+		if err != nil {
+			return seconds, err
+		}
+		seconds += clock.SecondsAt(now)
+	}
+	return seconds, nil
+}
+
+// clockOutEdit returns the edit that stops the running clock at now
+func clockOutEdit(src *NoteSource, clock *models.Clock, now time.Time) textedit.Edit {
+	row := clock.LineNumber - 1
+	line := strings.Split(string(src.Content), "\n")[row]
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	return textedit.Replace(row, indent, len(strings.TrimRight(line, "\r")), models.FormatClock(clock.StartTime(), now))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClockReport(t *testing.T) {
+	g := newTestGranite(t, map[string]string{
+		"note.md": strings.Join([]string{
+			"- [ ] #task #project big",
+			"  CLOCK: [2024-05-01 Wed 09:00]--[2024-05-01 Wed 10:00] =>  1:00",
+			"  - [ ] sub",
+			"    CLOCK: [2024-05-02 Thu 09:00]--[2024-05-02 Thu 11:00] =>  2:00",
+			"    - [x] #backend subsub",
+			"      CLOCK: [2024-05-02 Thu 13:00]--[2024-05-02 Thu 13:30] =>  0:30",
+			"- [ ] #task #other small",
+			"  CLOCK: [2024-05-03 Fri 09:00]--[2024-05-03 Fri 09:15] =>  0:15",
+			"",
+		}, "\n"),
+	})
+
+	tests := []struct {
+		args string
+		want ClockReport
+	}{
+		{
+			args: `{"tag": "#project"}`,
+			want: ClockReport{
+				TotalSeconds: 12600,
+				Tags:         map[string]int64{"#task": 12600, "#project": 12600, "#backend": 1800},
+				Folders:      map[string]int64{".": 12600},
+				Dates:        map[string]int64{"2024-05-01": 3600, "2024-05-02": 9000},
+			},
+		},
+		{
+			args: `{"tag": "#backend", "from": "2024-05-02"}`,
+			want: ClockReport{
+				TotalSeconds: 1800,
+				Tags:         map[string]int64{"#task": 1800, "#project": 1800, "#backend": 1800},
+				Folders:      map[string]int64{".": 1800},
+				Dates:        map[string]int64{"2024-05-02": 1800},
+			},
+		},
+	}
+	for _, tt := range tests {
+		raw, err := g.ClockReport(nil, []string{tt.args})
+		if err != nil {
+			t.Fatalf("%s: ClockReport() error = %v", tt.args, err)
+		}
+		got := ClockReport{}
+		if err := json.Unmarshal([]byte(raw), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ClockReport() = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/dates"
+	"github.com/mrWinston/granite.nvim/pkg/models"
+	"github.com/mrWinston/granite.nvim/pkg/textedit"
+	"github.com/neovim/go-client/nvim"
+)
+
+const FIND_BUFFER_LUA = `
+local path = ...
+for _, buf in ipairs(vim.api.nvim_list_bufs()) do
+	if vim.api.nvim_buf_is_loaded(buf) and vim.api.nvim_buf_get_name(buf) == path then
+		return { buf = buf, lines = vim.api.nvim_buf_get_lines(buf, 0, -1, false) }
+	end
+end
+return vim.NIL
+`
+
+const MODIFIED_BUFFERS_LUA = `
+local result = {}
+for _, buf in ipairs(vim.api.nvim_list_bufs()) do
+	if vim.api.nvim_buf_is_loaded(buf) and vim.bo[buf].modified then
+		table.insert(result, { name = vim.api.nvim_buf_get_name(buf), lines = vim.api.nvim_buf_get_lines(buf, 0, -1, false) })
+	end
+end
+return result
+`
+
+const APPLY_EDITS_LUA = `
+local buf, edits = ...
+for _, e in ipairs(edits) do
+	vim.api.nvim_buf_set_text(buf, e.start_row, e.start_col, e.end_row, e.end_col, e.lines)
+end
+`
+
+// TodoRef addresses a todo, either by its ID or by file and line. A line
+// refers to the innermost todo whose list item contains it and is only used
+// when there is no ID, so a stale ID never edits another todo.
+type TodoRef struct {
+	ID         string `json:"id,omitempty" yaml:"id,omitempty"`
+	FilePath   string `json:"filename,omitempty" yaml:"filename,omitempty"`
+	LineNumber int    `json:"lnum,omitempty" yaml:"lnum,omitempty"`
+}
+
+// NoteSource is the current content of a note. When the note is loaded in a
+// neovim buffer, the buffer is the source of truth, otherwise the file on
+// disk.
+type NoteSource struct {
+	Path    string
+	Buffer  nvim.Buffer
+	Loaded  bool
+	Content []byte
+}
+
+type bufferContent struct {
+	Buf   int      `msgpack:"buf"`
+	Name  string   `msgpack:"name"`
+	Lines []string `msgpack:"lines"`
+}
+
+// ModifiedNotes parses all notes that are loaded in a neovim buffer and have
+// unsaved changes. The result is keyed by path.
+func (g *Granite) ModifiedNotes(v *nvim.Nvim) (map[string]*models.Note, error) {
+	overlay := map[string]*models.Note{}
+	if v == nil {
+		return overlay, nil
+	}
+
+	buffers := []*bufferContent{}
+	err := v.ExecLua(MODIFIED_BUFFERS_LUA, &buffers)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get modified buffers: %w", err)
+	}
+
+	for _, buf := range buffers {
+		path := filepath.Clean(buf.Name)
+		if buf.Name == "" || !g.rules.IsNote(path) {
+			continue
+		}
+		note, err := g.ParseNote(path, []byte(strings.Join(buf.Lines, "\n")+"\n"))
+		if err != nil {
+			g.logger.Warnf("Error parsing unsaved buffer %s: %v", path, err)
+			continue
+		}
+		overlay[path] = note
+	}
+	return overlay, nil
+}
+
+// ReadNote returns the current content of the note at path
+func (g *Granite) ReadNote(v *nvim.Nvim, path string) (*NoteSource, error) {
+	path = filepath.Clean(path)
+	src := &NoteSource{Path: path}
+
+	if v != nil {
+		var buf *bufferContent
+		err := v.ExecLua(FIND_BUFFER_LUA, &buf, path)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to look up buffer for %s: %w", path, err)
+		}
+		if buf != nil {
+			src.Buffer = nvim.Buffer(buf.Buf)
+			src.Loaded = true
+			src.Content = []byte(strings.Join(buf.Lines, "\n") + "\n")
+			return src, nil
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src.Content = content
+	return src, nil
+}
+
+// WriteEdits applies edits to the note. Loaded buffers are changed through
+// the buffer api so the change can be undone, files on disk are replaced
+// atomically.
+func (g *Granite) WriteEdits(v *nvim.Nvim, src *NoteSource, edits []textedit.Edit) error {
+	if len(edits) == 0 {
+		return nil
+	}
+
+	if src.Loaded {
+		err := v.ExecLua(APPLY_EDITS_LUA, nil, src.Buffer, textedit.Sort(edits))
+		if err != nil {
+			return fmt.Errorf("Unable to edit buffer of %s: %w", src.Path, err)
+		}
+		return nil
+	}
+
+	content, err := textedit.Apply(src.Content, edits)
+	if err != nil {
+		return err
+	}
+
+	current, err := os.ReadFile(src.Path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, src.Content) {
+		return fmt.Errorf("%s changed on disk while editing it", src.Path)
+	}
+
+	err = textedit.WriteFileAtomic(src.Path, content)
+	if err != nil {
+		return fmt.Errorf("Unable to write %s: %w", src.Path, err)
+	}
+	if g.index != nil {
+		_, err = g.index.Update(src.Path)
+	}
+	return err
+}
+
+// ResolveTodo finds the todo ref points to in the current content of its note
+func (g *Granite) ResolveTodo(v *nvim.Nvim, ref *TodoRef) (*NoteSource, *models.Todo, error) {
+	path := ref.FilePath
+	if path == "" {
+		if ref.ID == "" {
+			return nil, nil, fmt.Errorf("Todo reference needs an id or a filename")
+		}
+		todos, err := g.GetAllTodos(context.Background())
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, t := range todos {
+			if t.ID == ref.ID {
+				path = t.FilePath
+				break
+			}
+		}
+		if path == "" {
+			return nil, nil, fmt.Errorf("No todo with id %s", ref.ID)
+		}
+	}
+
+	src, err := g.ReadNote(v, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	note, err := g.ParseNote(src.Path, src.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var found *models.Todo
+	if ref.ID != "" {
+		for _, t := range note.Todos {
+			if t.ID == ref.ID {
+				return src, t, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("No todo with id %s in %s", ref.ID, src.Path)
+	}
+	if ref.LineNumber > 0 {
+		// later todos are nested deeper, the last match is the innermost
+		for _, t := range note.Todos {
+			if t.LineNumber <= ref.LineNumber && ref.LineNumber <= t.EndLineNumber {
+				found = t
+			}
+		}
+	}
+
+	if found == nil {
+		return nil, nil, fmt.Errorf("No todo found in %s for %+v", src.Path, *ref)
+	}
+	return src, found, nil
+}
+
+func parseTodoRef(arg string) (*TodoRef, error) {
+	ref := &TodoRef{}
+	err := json.Unmarshal([]byte(arg), ref)
+	if err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// newAnchor returns a random block anchor like t-k3x9qa
+func newAnchor() (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := strings.Builder{}
+	b.WriteString(models.ANCHOR_PREFIX)
+	for i := 0; i < 6; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(alphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// AnchorTodo adds a block anchor to the todo referenced by args[0], a json
+// encoded TodoRef, and returns it. Todos that already have an anchor keep it.
+func (g *Granite) AnchorTodo(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called AnchorTodo with args: %v", args)
+	if len(args) != 1 {
+		g.logger.Errorf("AnchorTodo expects exactly 1 argument.")
+		return "", fmt.Errorf("AnchorTodo expects exactly 1 argument.")
+	}
+
+	ref, err := parseTodoRef(args[0])
+	if err != nil {
+		g.logger.Errorf("Cannot parse todo reference: %v", err)
+		return "", fmt.Errorf("Cannot parse todo reference: %w", err)
+	}
+
+	src, todo, err := g.ResolveTodo(v, ref)
+	if err != nil {
+		g.logger.Errorf("Cannot find todo: %v", err)
+		return "", fmt.Errorf("Cannot find todo: %w", err)
+	}
+
+	if todo.Anchor != "" {
+		return todo.Anchor, nil
+	}
+
+	anchor, err := newAnchor()
+	if err != nil {
+		return "", err
+	}
+
+	col := len(strings.TrimRight(todo.RawLine, " \t\r"))
+	err = g.WriteEdits(v, src, []textedit.Edit{
+		textedit.Insert(todo.LineNumber-1, col, " ^"+anchor),
+	})
+	if err != nil {
+		g.logger.Errorf("Cannot write anchor: %v", err)
+		return "", fmt.Errorf("Cannot write anchor: %w", err)
+	}
+
+	return anchor, nil
+}
+
+// SetTodoState changes the state marker of a todo. args[0] is a json encoded
+// TodoRef, args[1] the target state, either a state name like DONE or a
+// marker like [x]. Returns the new state.
+func (g *Granite) SetTodoState(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called SetTodoState with args: %v", args)
+	if len(args) != 2 {
+		g.logger.Errorf("SetTodoState expects exactly 2 arguments.")
+		return "", fmt.Errorf("SetTodoState expects exactly 2 arguments.")
+	}
+
+	ref, err := parseTodoRef(args[0])
+	if err != nil {
+		g.logger.Errorf("Cannot parse todo reference: %v", err)
+		return "", fmt.Errorf("Cannot parse todo reference: %w", err)
+	}
+
+	state, err := g.States.Resolve(args[1])
+	if err != nil {
+		g.logger.Errorf("Cannot set todo state: %v", err)
+		return "", fmt.Errorf("Cannot set todo state: %w", err)
+	}
+
+	src, todo, err := g.ResolveTodo(v, ref)
+	if err != nil {
+		g.logger.Errorf("Cannot find todo: %v", err)
+		return "", fmt.Errorf("Cannot find todo: %w", err)
+	}
+
+	return g.changeState(v, src, todo, state)
+}
+
+// CycleTodoState moves a todo to the next state of the configured cycle.
+// args[0] is a json encoded TodoRef. Returns the new state.
+func (g *Granite) CycleTodoState(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called CycleTodoState with args: %v", args)
+	if len(args) != 1 {
+		g.logger.Errorf("CycleTodoState expects exactly 1 argument.")
+		return "", fmt.Errorf("CycleTodoState expects exactly 1 argument.")
+	}
+
+	ref, err := parseTodoRef(args[0])
+	if err != nil {
+		g.logger.Errorf("Cannot parse todo reference: %v", err)
+		return "", fmt.Errorf("Cannot parse todo reference: %w", err)
+	}
+
+	src, todo, err := g.ResolveTodo(v, ref)
+	if err != nil {
+		g.logger.Errorf("Cannot find todo: %v", err)
+		return "", fmt.Errorf("Cannot find todo: %w", err)
+	}
+
+	return g.changeState(v, src, todo, g.States.Next(todo.StateString))
+}
+
+// changeState writes the first marker of state into the note of todo and
+// stamps or removes its done: date. When a recurring todo is closed, its next
+// occurrence is inserted below it.
+func (g *Granite) changeState(v *nvim.Nvim, src *NoteSource, todo *models.Todo, state *models.State) (string, error) {
+	edits, err := g.changeStateEdits(src, todo, state, time.Now())
+	if err != nil {
+		g.logger.Errorf("Cannot create next occurrence: %v", err)
+		return "", fmt.Errorf("Cannot create next occurrence: %w", err)
+	}
+
+	err = g.WriteEdits(v, src, edits)
+	if err != nil {
+		g.logger.Errorf("Cannot write todo state: %v", err)
+		return "", fmt.Errorf("Cannot write todo state: %w", err)
+	}
+	return state.Name, nil
+}
+
+// changeStateEdits returns the edits of changeState for a change at now
+func (g *Granite) changeStateEdits(src *NoteSource, todo *models.Todo, state *models.State, now time.Time) ([]textedit.Edit, error) {
+	// edits at the same position are applied in order, the next occurrence
+	// has to come first to end up behind the done: stamp
+	edits := []textedit.Edit{}
+	if state.Closed && !todo.Closed && todo.Recurrence != nil {
+		next, err := g.recurrenceEdits(src, todo, now)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, next...)
+	}
+	edits = append(edits, g.stateEdits(todo, state)...)
+	edits = append(edits, g.stampEdits(todo, state, now)...)
+	return edits, nil
+}
+
+// stateEdits returns the edits that change the marker of todo to state
+func (g *Granite) stateEdits(todo *models.Todo, state *models.State) []textedit.Edit {
+	r := todo.MarkerRange
+	return []textedit.Edit{
+		textedit.Replace(r.StartLine-1, r.StartCol, r.EndCol, state.Markers[0]),
+	}
+}
+
+// ResolveDates rewrites the relative date fields of the todos in the note at
+// args[0], like due:tomorrow, into absolute dates, so they don't drift when
+// the note is parsed again later. Dates the note has no anchor for are
+// resolved against today. Returns the number of rewritten fields.
+func (g *Granite) ResolveDates(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called ResolveDates with args: %v", args)
+	if len(args) != 1 {
+		g.logger.Errorf("ResolveDates expects exactly 1 argument.")
+		return "", fmt.Errorf("ResolveDates expects exactly 1 argument.")
+	}
+
+	src, err := g.ReadNote(v, args[0])
+	if err != nil {
+		g.logger.Errorf("Cannot read note %s: %v", args[0], err)
+		return "", fmt.Errorf("Cannot read note %s: %w", args[0], err)
+	}
+	note, err := g.ParseNote(src.Path, src.Content)
+	if err != nil {
+		g.logger.Errorf("Cannot parse note %s: %v", src.Path, err)
+		return "", fmt.Errorf("Cannot parse note %s: %w", src.Path, err)
+	}
+
+	now := time.Now()
+	edits := []textedit.Edit{}
+	for _, todo := range note.Todos {
+		for _, field := range todo.Fields {
+			if !field.Relative {
+				continue
+			}
+			if field.Date == "" {
+				field.Resolve(now)
+			}
+			edits = append(edits, textedit.Replace(todo.LineNumber-1, field.ValueCol, field.ValueEndCol, field.Date))
+		}
+	}
+
+	err = g.WriteEdits(v, src, edits)
+	if err != nil {
+		g.logger.Errorf("Cannot write resolved dates: %v", err)
+		return "", fmt.Errorf("Cannot write resolved dates: %w", err)
+	}
+	return strconv.Itoa(len(edits)), nil
+}
+
+// stampEdits returns the edits that stamp done: with the date of now when
+// todo is closed and remove the stamp when it is opened again
+func (g *Granite) stampEdits(todo *models.Todo, state *models.State, now time.Time) []textedit.Edit {
+	row := todo.LineNumber - 1
+	today := now.Format(models.DATE_FORMAT)
+	done, hasDone := todo.Fields["done"]
+
+	switch {
+	case state.Closed && !todo.Closed && hasDone:
+		return []textedit.Edit{textedit.Replace(row, done.ValueCol, done.ValueEndCol, today)}
+	case state.Closed && !todo.Closed:
+		return []textedit.Edit{textedit.Insert(row, fieldCol(todo), " done:"+today)}
+	case !state.Closed:
+		if edit, ok := removeField(todo, "done", row); ok {
+			return []textedit.Edit{edit}
+		}
+	}
+	return nil
+}
+
+// fieldCol is the column new fields are appended to the first line of todo,
+// in front of its block anchor
+func fieldCol(todo *models.Todo) int {
+	if start, _, ok := todo.AnchorSpan(); ok {
+		return start
+	}
+	return len(strings.TrimRight(todo.RawLine, " \t\r"))
+}
+
+// removeField returns the edit that removes the field key of todo, together
+// with the whitespace in front of it, from row
+func removeField(todo *models.Todo, key string, row int) (textedit.Edit, bool) {
+	field, ok := todo.Fields[key]
+	if !ok {
+		return textedit.Edit{}, false
+	}
+	start := field.Col
+	for start > 0 && (todo.RawLine[start-1] == ' ' || todo.RawLine[start-1] == '\t') {
+		start--
+	}
+	return textedit.Replace(row, start, field.EndCol, ""), true
+}
+
+// recurrenceEdits returns the edits that insert the next occurrence of the
+// recurring todo below its list item. The copy and its subtasks are open and
+// lose their block anchors, done: stamps and clocks, the due date moves to the next
+// occurrence after today and the other date fields move along with it.
+// Occurrences missed while the todo was overdue are skipped. No edits are
+// returned when the recurrence ended.
+func (g *Granite) recurrenceEdits(src *NoteSource, todo *models.Todo, now time.Time) ([]textedit.Edit, error) {
+	lines := strings.Split(string(src.Content), "\n")
+	if todo.EndLineNumber > len(lines) {
+		return nil, fmt.Errorf("Todo in %s ends after the last line", src.Path)
+	}
+	item := lines[todo.LineNumber-1 : todo.EndLineNumber]
+
+	from := dates.Day(now)
+	due, hasDue := todo.Fields["due"]
+	if hasDue && due.Relative && due.Date == "" {
+		due.Resolve(now)
+	}
+	if hasDue && due.Date != "" {
+		from, _ = time.Parse(models.DATE_FORMAT, due.Date)
+	}
+	today := now.Format(models.DATE_FORMAT)
+	next, ok := todo.Recurrence.Next(from)
+	for ok && next.Format(models.DATE_FORMAT) <= today {
+		next, ok = todo.Recurrence.Next(next)
+	}
+	if !ok {
+		return nil, nil
+	}
+	shift := int(next.Sub(from).Hours() / 24)
+
+	open := g.States.States[0].Markers[0]
+	edits := []textedit.Edit{}
+	var reset func(t *models.Todo)
+	reset = func(t *models.Todo) {
+		row := t.LineNumber - todo.LineNumber
+		edits = append(edits, textedit.Replace(row, t.MarkerRange.StartCol, t.MarkerRange.EndCol, open))
+		if start, end, ok := t.AnchorSpan(); ok {
+			edits = append(edits, textedit.Replace(row, start, end, ""))
+		}
+		if edit, ok := removeField(t, "done", row); ok {
+			edits = append(edits, edit)
+		}
+		for _, child := range t.Children {
+			reset(child)
+		}
+	}
+	reset(todo)
+
+	for _, key := range models.DATE_FIELDS {
+		field, ok := todo.Fields[key]
+		if !ok {
+			continue
+		}
+		if field.Relative && field.Date == "" {
+			field.Resolve(now)
+		}
+		date, err := time.Parse(models.DATE_FORMAT, field.Date)
+		if err != nil {
+			continue
+		}
+		edits = append(edits, textedit.Replace(0, field.ValueCol, field.ValueEndCol, date.AddDate(0, 0, shift).Format(models.DATE_FORMAT)))
+	}
+	if !hasDue || due.Date == "" {
+		edits = append(edits, textedit.Insert(0, fieldCol(todo), " due:"+next.Format(models.DATE_FORMAT)))
+	}
+
+	copied, err := textedit.Apply([]byte(strings.Join(item, "\n")), edits)
+	if err != nil {
+		return nil, err
+	}
+
+	// the clocks stay with the completed occurrence
+	inserted := []string{""}
+	for _, line := range strings.Split(string(copied), "\n") {
+		if !models.IsClockLine(line) {
+			inserted = append(inserted, line)
+		}
+	}
+	last := todo.EndLineNumber - 1
+	return []textedit.Edit{
+		textedit.Insert(last, len(lines[last]), inserted...),
+	}, nil
+}
+
+// CaptureArgs are the arguments of CaptureTodo
+type CaptureArgs struct {
+	// FilePath is the note the todo is added to
+	FilePath string `json:"filename" yaml:"filename"`
+	// LineNumber is the line the todo is inserted below. Without it the todo
+	// is appended to the end of the note
+	LineNumber int `json:"lnum,omitempty" yaml:"lnum,omitempty"`
+	// Text of the todo. The todo tag is added when it's missing
+	Text string `json:"text" yaml:"text"`
+}
+
+// CaptureTodo adds a new open todo to a note. args[0] are json encoded
+// CaptureArgs. With stamp_created set in the config, the todo gets a created:
+// field with the current date. Returns a json encoded TodoRef of the new todo.
+func (g *Granite) CaptureTodo(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called CaptureTodo with args: %v", args)
+	if len(args) != 1 {
+		g.logger.Errorf("CaptureTodo expects exactly 1 argument.")
+		return "", fmt.Errorf("CaptureTodo expects exactly 1 argument.")
+	}
+
+	captureArgs := &CaptureArgs{}
+	err := json.Unmarshal([]byte(args[0]), captureArgs)
+	if err != nil {
+		g.logger.Errorf("Cannot parse capture arguments: %v", err)
+		return "", fmt.Errorf("Cannot parse capture arguments: %w", err)
+	}
+	text := strings.TrimSpace(captureArgs.Text)
+	if text == "" {
+		g.logger.Errorf("Cannot capture a todo without text")
+		return "", fmt.Errorf("Cannot capture a todo without text")
+	}
+
+	src, err := g.ReadNote(v, captureArgs.FilePath)
+	if err != nil {
+		g.logger.Errorf("Cannot read note %s: %v", captureArgs.FilePath, err)
+		return "", fmt.Errorf("Cannot read note %s: %w", captureArgs.FilePath, err)
+	}
+
+	edit, lnum := g.captureEdit(src, text, captureArgs.LineNumber, time.Now())
+	err = g.WriteEdits(v, src, []textedit.Edit{edit})
+	if err != nil {
+		g.logger.Errorf("Cannot write captured todo: %v", err)
+		return "", fmt.Errorf("Cannot write captured todo: %w", err)
+	}
+
+	rawJson, err := json.Marshal(&TodoRef{FilePath: src.Path, LineNumber: lnum})
+	return string(rawJson), err
+}
+
+// captureEdit returns the edit that inserts an open todo with text below
+// line lnum of the note, or at its end without lnum, and the line of the new
+// todo. created: is stamped with the date of now when StampCreated is set.
+func (g *Granite) captureEdit(src *NoteSource, text string, lnum int, now time.Time) (textedit.Edit, int) {
+	if g.TodoTag != "" && !strings.Contains(text, g.TodoTag) {
+		text = g.TodoTag + " " + text
+	}
+	line := "- " + g.States.States[0].Markers[0] + " " + text
+	if g.StampCreated {
+		line += " created:" + now.Format(models.DATE_FORMAT)
+	}
+
+	lines := strings.Split(string(src.Content), "\n")
+	last := len(lines) - 1
+	switch {
+	case lnum > 0 && lnum <= last:
+		row := lnum - 1
+		return textedit.Insert(row, len(lines[row]), "", line), lnum + 1
+	case lines[last] == "":
+		// the note ends with a newline
+		return textedit.InsertLines(last, line), last + 1
+	default:
+		return textedit.Insert(last, len(lines[last]), "", line), last + 2
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/index"
+	"github.com/mrWinston/granite.nvim/pkg/models"
+	"github.com/mrWinston/granite.nvim/pkg/textedit"
+	"github.com/mrWinston/granite.nvim/pkg/vault"
+	log "github.com/sirupsen/logrus"
+)
+
+// newTestGranite returns a Granite for the vault in a temporary directory
+// with the given notes, indexed in another temporary directory
+func newTestGranite(t *testing.T, notes map[string]string) *Granite {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range notes {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := &Granite{
+		RootPath:      root,
+		TodoTag:       "#task",
+		States:        models.DefaultStateConfig,
+		PriorityEmoji: models.DefaultPriorityEmoji,
+		logger:        log.New(),
+	}
+	rules, err := vault.NewRules(root, vault.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.rules = rules
+	g.index = index.New(filepath.Join(t.TempDir(), "index.json"), g.indexKey(), g.ParseNote)
+	return g
+}
+
+func TestResolveTodo(t *testing.T) {
+	g := newTestGranite(t, map[string]string{
+		"note.md": strings.Join([]string{
+			"- [ ] #task inserted above",
+			"- [ ] #task anchored ^t-abc123",
+			"- [ ] #task plain",
+			"",
+		}, "\n"),
+	})
+	path := filepath.Join(g.RootPath, "note.md")
+
+	tests := []struct {
+		name string
+		ref  TodoRef
+		want string
+	}{
+		{"id wins over the line", TodoRef{ID: "t-abc123", FilePath: path, LineNumber: 3}, "t-abc123"},
+		{"line without id", TodoRef{FilePath: path, LineNumber: 3}, "plain"},
+		{"stale id", TodoRef{ID: "t-gone00", FilePath: path, LineNumber: 2}, ""},
+	}
+	for _, tt := range tests {
+		_, todo, err := g.ResolveTodo(nil, &tt.ref)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: ResolveTodo() = %q, want an error", tt.name, todo.Text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ResolveTodo() error = %v", tt.name, err)
+			continue
+		}
+		if !strings.Contains(todo.RawLine, tt.want) {
+			t.Errorf("%s: ResolveTodo() = %q, want the todo with %q", tt.name, todo.RawLine, tt.want)
+		}
+	}
+}
+
+// changeStateText changes the todo on line lnum of content to state at now
+// and returns the changed content
+func changeStateText(t *testing.T, g *Granite, content string, lnum int, state string, now time.Time) string {
+	t.Helper()
+	src := &NoteSource{Path: filepath.Join(g.RootPath, "note.md"), Content: []byte(content)}
+	note, err := g.ParseNote(src.Path, src.Content)
+	if err != nil {
+		t.Fatalf("ParseNote() error = %v", err)
+	}
+	var todo *models.Todo
+	for _, candidate := range note.Todos {
+		if candidate.LineNumber == lnum {
+			todo = candidate
+		}
+	}
+	if todo == nil {
+		t.Fatalf("no todo on line %d of %q", lnum, content)
+	}
+	target, err := g.States.Resolve(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edits, err := g.changeStateEdits(src, todo, target, now)
+	if err != nil {
+		t.Fatalf("changeStateEdits() error = %v", err)
+	}
+	changed, err := textedit.Apply(src.Content, edits)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	return string(changed)
+}
+
+func TestRecurrenceEdits(t *testing.T) {
+	g := newTestGranite(t, nil)
+	// a wednesday
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		content []string
+		want    []string
+	}{
+		{
+			name: "closed subtasks lose their done stamps",
+			content: []string{
+				"- [ ] #task weekly review every:week due:2024-05-13",
+				"  - [x] inbox zero done:2024-05-14 ^t-sub111",
+				"",
+			},
+			want: []string{
+				"- [x] #task weekly review every:week due:2024-05-13 done:2024-05-15",
+				"  - [x] inbox zero done:2024-05-14 ^t-sub111",
+				"- [ ] #task weekly review every:week due:2024-05-20",
+				"  - [ ] inbox zero",
+				"",
+			},
+		},
+		{
+			name: "clocks stay with the completed occurrence",
+			content: []string{
+				"- [ ] #task client call every:week due:2024-05-15",
+				"  CLOCK: [2024-05-15 Wed 09:00]",
+				"  CLOCK: [2024-05-08 Wed 09:00]--[2024-05-08 Wed 10:30] =>  1:30",
+				"  - [ ] send the notes",
+				"    CLOCK: [2024-05-08 Wed 11:00]--[2024-05-08 Wed 11:15] =>  0:15",
+				"",
+			},
+			want: []string{
+				"- [x] #task client call every:week due:2024-05-15 done:2024-05-15",
+				"  CLOCK: [2024-05-15 Wed 09:00]",
+				"  CLOCK: [2024-05-08 Wed 09:00]--[2024-05-08 Wed 10:30] =>  1:30",
+				"  - [ ] send the notes",
+				"    CLOCK: [2024-05-08 Wed 11:00]--[2024-05-08 Wed 11:15] =>  0:15",
+				"- [ ] #task client call every:week due:2024-05-22",
+				"  - [ ] send the notes",
+				"",
+			},
+		},
+		{
+			name: "overdue occurrences are skipped",
+			content: []string{
+				"- [ ] #task invoice every:week due:2024-04-29 scheduled:2024-04-28",
+				"",
+			},
+			want: []string{
+				"- [x] #task invoice every:week due:2024-04-29 scheduled:2024-04-28 done:2024-05-15",
+				"- [ ] #task invoice every:week due:2024-05-20 scheduled:2024-05-19",
+				"",
+			},
+		},
+		{
+			name: "undated todos are due after today",
+			content: []string{
+				"- [ ] #task water the plants every:2 days",
+				"",
+			},
+			want: []string{
+				"- [x] #task water the plants every:2 days done:2024-05-15",
+				"- [ ] #task water the plants every:2 days due:2024-05-17",
+				"",
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := changeStateText(t, g, strings.Join(tt.content, "\n"), 1, "DONE", now)
+		if want := strings.Join(tt.want, "\n"); got != want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestChangeStateEdits(t *testing.T) {
+	g := newTestGranite(t, nil)
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		content []string
+		lnum    int
+		state   string
+		want    []string
+	}{
+		{
+			name:    "closing stamps done",
+			content: []string{"- [ ] #task write report"},
+			lnum:    1,
+			state:   "DONE",
+			want:    []string{"- [x] #task write report done:2024-05-15"},
+		},
+		{
+			name:    "the stamp goes in front of the block anchor",
+			content: []string{"- [/] #task write report ^t-abc123"},
+			lnum:    1,
+			state:   "[x]",
+			want:    []string{"- [x] #task write report done:2024-05-15 ^t-abc123"},
+		},
+		{
+			name:    "closing again replaces the stamp",
+			content: []string{"- [ ] #task write report done:2024-05-01"},
+			lnum:    1,
+			state:   "DONE",
+			want:    []string{"- [x] #task write report done:2024-05-15"},
+		},
+		{
+			name:    "reopening removes the stamp",
+			content: []string{"- [x] #task write report done:2024-05-01 due:2024-05-20"},
+			lnum:    1,
+			state:   "OPEN",
+			want:    []string{"- [ ] #task write report due:2024-05-20"},
+		},
+		{
+			name:    "reopening removes dataview stamps",
+			content: []string{"- [x] #task write report [done:: 2024-05-01]"},
+			lnum:    1,
+			state:   "IN_PROGRESS",
+			want:    []string{"- [/] #task write report"},
+		},
+		{
+			name:    "closed to closed keeps the stamp",
+			content: []string{"- [X] #task write report done:2024-05-01"},
+			lnum:    1,
+			state:   "DONE",
+			want:    []string{"- [x] #task write report done:2024-05-01"},
+		},
+		{
+			name:    "the next occurrence goes behind the stamp of the same line",
+			content: []string{"- [ ] #task standup every:day due:2024-05-15"},
+			lnum:    1,
+			state:   "DONE",
+			want: []string{
+				"- [x] #task standup every:day due:2024-05-15 done:2024-05-15",
+				"- [ ] #task standup every:day due:2024-05-16",
+			},
+		},
+		{
+			name: "multi line items are stamped on their first line",
+			content: []string{
+				"- [ ] #task deploy the service",
+				"  to production",
+				"  - [ ] check the dashboards",
+				"  - [x] announce it done:2024-05-14",
+				"- [ ] #task next",
+			},
+			lnum:  1,
+			state: "DONE",
+			want: []string{
+				"- [x] #task deploy the service done:2024-05-15",
+				"  to production",
+				"  - [ ] check the dashboards",
+				"  - [x] announce it done:2024-05-14",
+				"- [ ] #task next",
+			},
+		},
+		{
+			name: "subtasks are stamped on their own line",
+			content: []string{
+				"- [ ] #task deploy the service",
+				"  - [ ] check the dashboards",
+				"  - [x] announce it done:2024-05-14",
+			},
+			lnum:  3,
+			state: "OPEN",
+			want: []string{
+				"- [ ] #task deploy the service",
+				"  - [ ] check the dashboards",
+				"  - [ ] announce it",
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := changeStateText(t, g, strings.Join(tt.content, "\n"), tt.lnum, tt.state, now)
+		if want := strings.Join(tt.want, "\n"); got != want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestCaptureEdit(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name         string
+		content      string
+		text         string
+		lnum         int
+		stampCreated bool
+		want         string
+		wantLnum     int
+	}{
+		{"appended to a note ending with a newline", "# Inbox\n", "call the bank", 0, false, "# Inbox\n- [ ] #task call the bank\n", 2},
+		{"appended to a note without a newline", "# Inbox", "call the bank", 0, false, "# Inbox\n- [ ] #task call the bank", 2},
+		{"inserted below a line", "# Inbox\n- [ ] #task old\n", "#task new", 1, false, "# Inbox\n- [ ] #task new\n- [ ] #task old\n", 2},
+		{"stamped with created", "# Inbox\n", "call the bank", 0, true, "# Inbox\n- [ ] #task call the bank created:2024-05-15\n", 2},
+	}
+	for _, tt := range tests {
+		g := newTestGranite(t, nil)
+		g.StampCreated = tt.stampCreated
+		src := &NoteSource{Path: filepath.Join(g.RootPath, "inbox.md"), Content: []byte(tt.content)}
+
+		edit, lnum := g.captureEdit(src, tt.text, tt.lnum, now)
+		got, err := textedit.Apply(src.Content, []textedit.Edit{edit})
+		if err != nil {
+			t.Fatalf("%s: Apply() error = %v", tt.name, err)
+		}
+		if string(got) != tt.want || lnum != tt.wantLnum {
+			t.Errorf("%s: captured %q on line %d, want %q on line %d", tt.name, got, lnum, tt.want, tt.wantLnum)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+	"github.com/neovim/go-client/nvim"
+)
+
+// EffortReportArgs select the todos of an EffortReport
+type EffortReportArgs struct {
+	// Tag limits the report to todos with a tag matching this pattern, see
+	// tagquery.ParsePattern
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty"`
+}
+
+// EffortReport sums up the estimated work of todos. Every estimate counts
+// once per group, even when its todo is nested in another estimated todo. A
+// todo with several tags counts for each of them, so the tag sums can add up
+// to more than the total. Subtasks count for their own tags and those of the
+// todos they are nested in.
+type EffortReport struct {
+	Total models.Effort `json:"total"`
+	// Tags holds the effort per tag
+	Tags map[string]*models.Effort `json:"tags"`
+	// Notes holds the effort per note, relative to the vault root
+	Notes map[string]*models.Effort `json:"notes"`
+	// Headings holds the effort per heading as note#heading, todos above the
+	// first heading of a note don't count for any heading
+	Headings map[string]*models.Effort `json:"headings"`
+}
+
+// GetEffort sums up the remaining and completed estimated work of all todos
+// per tag, note and heading. args[0] are json encoded EffortReportArgs.
+func (g *Granite) GetEffort(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called GetEffort with args: %v", args)
+	reportArgs := &EffortReportArgs{}
+	if len(args) > 0 && args[0] != "" {
+		err := json.Unmarshal([]byte(args[0]), reportArgs)
+		if err != nil {
+			g.logger.Errorf("Cannot parse effort arguments: %v", err)
+			return "", fmt.Errorf("Cannot parse effort arguments: %w", err)
+		}
+	}
+
+	pattern, err := g.parseTagFilter(reportArgs.Tag)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, done := g.supersede("GetEffort")
+	defer done()
+	todos, err := g.GetCurrentTodos(ctx, v)
+	if err != nil {
+		g.logger.Errorf("Error getting todos from markdown files: %v", err)
+		return "", fmt.Errorf("Error getting todos from markdown files: %w", err)
+	}
+
+	report := &EffortReport{
+		Tags:     map[string]*models.Effort{},
+		Notes:    map[string]*models.Effort{},
+		Headings: map[string]*models.Effort{},
+	}
+	add := func(groups map[string]*models.Effort, key string, effort models.Effort) {
+		if _, ok := groups[key]; !ok {
+			groups[key] = &models.Effort{}
+		}
+		groups[key].Add(effort)
+	}
+	for _, todo := range todos {
+		// subtasks count for the tags of their parents
+		tags := todo.InheritedTags()
+		if pattern != nil && !pattern.MatchAny(tags) {
+			continue
+		}
+		effort := todo.OwnEffort()
+		if effort == (models.Effort{}) {
+			continue
+		}
+		note, err := filepath.Rel(g.RootPath, todo.FilePath)
+		if err != nil {
+			note = todo.FilePath
+		}
+		report.Total.Add(effort)
+		add(report.Notes, note, effort)
+		if todo.Heading != "" {
+			add(report.Headings, note+"#"+todo.Heading, effort)
+		}
+		for _, tag := range tags {
+			add(report.Tags, tag, effort)
+		}
+	}
+
+	rawJson, err := json.Marshal(report)
+	return string(rawJson), err
+}
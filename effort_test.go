@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+)
+
+func TestGetEffort(t *testing.T) {
+	g := newTestGranite(t, map[string]string{
+		"note.md": strings.Join([]string{
+			"# Plan",
+			"- [ ] #task #project big ~5h",
+			"  - [ ] sub ~2h",
+			"  - [x] sub2 ~1h",
+			"    - [ ] #backend subsub",
+			"- [ ] #task #other small ~30m",
+			"",
+		}, "\n"),
+	})
+
+	raw, err := g.GetEffort(nil, []string{`{"tag": "#project"}`})
+	if err != nil {
+		t.Fatalf("GetEffort() error = %v", err)
+	}
+	got := EffortReport{}
+	if err := json.Unmarshal([]byte(raw), &got); err != nil {
+		t.Fatal(err)
+	}
+	project := &models.Effort{RemainingSeconds: 4 * 3600, CompletedSeconds: 3600}
+	want := EffortReport{
+		Total: *project,
+		Tags: map[string]*models.Effort{
+			"#task":    project,
+			"#project": project,
+		},
+		Notes:    map[string]*models.Effort{"note.md": project},
+		Headings: map[string]*models.Effort{"note.md#Plan": project},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetEffort() = %+v, want %+v", got, want)
+	}
+}
@@ -1,38 +1,27 @@
 module github.com/mrWinston/granite.nvim
 
-go 1.19
+go 1.21
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/neovim/go-client v1.2.1
 	github.com/sirupsen/logrus v1.9.3
 )
 
 require (
-	github.com/BurntSushi/toml v1.2.1 // indirect
 	github.com/Masterminds/goutils v1.1.1 // indirect
 	github.com/Masterminds/semver/v3 v3.2.0 // indirect
-	github.com/cweill/gotests v1.6.0 // indirect
-	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/google/uuid v1.1.1 // indirect
 	github.com/huandu/xstrings v1.3.3 // indirect
 	github.com/imdario/mergo v0.3.11 // indirect
+	github.com/kr/pretty v0.3.0 // indirect
 	github.com/mitchellh/copystructure v1.0.0 // indirect
 	github.com/mitchellh/reflectwalk v1.0.0 // indirect
-	github.com/sergi/go-diff v1.1.0 // indirect
+	github.com/rogpeppe/go-internal v1.9.0 // indirect
 	github.com/shopspring/decimal v1.2.0 // indirect
 	github.com/spf13/cast v1.3.1 // indirect
 	golang.org/x/crypto v0.3.0 // indirect
-	golang.org/x/exp v0.0.0-20220722155223-a9213eeb770e // indirect
-	golang.org/x/exp/typeparams v0.0.0-20221212164502-fae10dda9338 // indirect
-	golang.org/x/mod v0.14.0 // indirect
-	golang.org/x/sync v0.5.0 // indirect
-	golang.org/x/text v0.11.0 // indirect
-	golang.org/x/tools v0.15.0 // indirect
-	golang.org/x/tools/gopls v0.13.2 // indirect
-	golang.org/x/vuln v0.0.0-20230110180137-6ad3e3d07815 // indirect
-	honnef.co/go/tools v0.4.2 // indirect
-	mvdan.cc/gofumpt v0.4.0 // indirect
-	mvdan.cc/xurls/v2 v2.4.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 )
 
 require (
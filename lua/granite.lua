@@ -48,12 +48,27 @@ M.setup = function(opts)
     call remote#host#Register('granite', 'x', function('s:RequireGranite'))
 
     call remote#host#RegisterPlugin('granite', '0', [
+    \ {'type': 'function', 'name': 'GraniteAnchorTodo', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteCaptureTodo', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteCheckQuery', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteClockIn', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteClockOut', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteClockReport', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteCycleTodoState', 'sync': 1, 'opts': {}},
     \ {'type': 'function', 'name': 'GraniteGetAllTags', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteGetDependencyGraph', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteGetEffort', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteGetPeople', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteGetStates', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteGetTagTree', 'sync': 1, 'opts': {}},
     \ {'type': 'function', 'name': 'GraniteGetTemplates', 'sync': 1, 'opts': {}},
     \ {'type': 'function', 'name': 'GraniteGetTodos', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteGetViews', 'sync': 1, 'opts': {}},
     \ {'type': 'function', 'name': 'GraniteInit', 'sync': 1, 'opts': {}},
     \ {'type': 'function', 'name': 'GraniteRenderTemplate', 'sync': 1, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteResolveDates', 'sync': 1, 'opts': {}},
     \ {'type': 'function', 'name': 'GraniteRunCodeblock', 'sync': 0, 'opts': {}},
+    \ {'type': 'function', 'name': 'GraniteSetTodoState', 'sync': 1, 'opts': {}},
     \ ])
 
   ]])
@@ -63,6 +78,7 @@ M.setup = function(opts)
 		log_level = "debug",
 	}
 	vim.fn.GraniteInit(vim.fn.json_encode(goConfig))
+	mod.set_states(vim.fn.json_decode(vim.fn.GraniteGetStates()).states)
 end
 
 M.new_note_from_template = a.void(function()
@@ -132,9 +148,25 @@ M.ParseCodequeries = function()
 
 		if codeblock.language:match("granite") then
 			local filter = {
+				view = codeblock.language:match('view="(%S-)"'),
+				group_by = codeblock.language:match('group_by="(%S-)"'),
 				due = codeblock.language:match('due="(%S-)"'),
-				tag_query = codeblock.language:match('tags="(.-)"'),
+				-- queries with double quotes can be wrapped in single quotes
+				tag_query = codeblock.language:match("tags='(.-)'") or codeblock.language:match('tags="(.-)"'),
+				assignee = codeblock.language:match('assignee="(%S-)"'),
+				sort = codeblock.language:match('sort="(%S-)"'),
+				limit = tonumber(codeblock.language:match('limit="(%d-)"')),
 			}
+			if filter.tag_query then
+				local err = M.check_query(filter.tag_query)
+				if err then
+					vim.notify(
+						string.format("Invalid query at column %d: %s\n%s\n%s^", err.col, err.message, filter.tag_query, string.rep(" ", err.col - 1)),
+						vim.log.levels.ERROR
+					)
+					return
+				end
+			end
 			local states_raw = codeblock.language:match('states="(%S-)"')
 			if states_raw then
 				filter.states = mysplit(states_raw, ",")
@@ -142,10 +174,21 @@ M.ParseCodequeries = function()
 
 			local todos = M.get_all_todos(filter)
 			local inserted_lines = {}
-			for _, todo in ipairs(todos) do
-				local withouttask = string.gsub(todo.text, " #task", "")
-				local tasklink = string.format("[link](%s)", bufutils.get_buffer_relative_path(0, todo.filename))
-				table.insert(inserted_lines, string.format("- %s - %s", withouttask, tasklink))
+			local insert_todos = function(group)
+				for _, todo in ipairs(group) do
+					local withouttask = string.gsub(todo.text, " #task", "")
+					local tasklink = string.format("[link](%s)", bufutils.get_buffer_relative_path(0, todo.filename))
+					table.insert(inserted_lines, string.format("- %s - %s", withouttask, tasklink))
+				end
+			end
+			-- views can group their todos
+			if todos[1] and todos[1].todos then
+				for _, group in ipairs(todos) do
+					table.insert(inserted_lines, string.format("**%s**", group.key ~= "" and group.key or "Other"))
+					insert_todos(group.todos)
+				end
+			else
+				insert_todos(todos)
 			end
 			vim.api.nvim_buf_set_lines(0, codeblock.start_row, codeblock.end_row, true, inserted_lines)
 		end
@@ -175,9 +218,162 @@ M.newHandwritten = function()
 	bufutils.write_at_cursor(0, string.format("[notes](%s)", relative_path))
 end
 
+---Add a block anchor to the todo under the cursor and return it
+---@return string anchor
+M.anchor_todo = function()
+	local ref = {
+		filename = vim.api.nvim_buf_get_name(0),
+		lnum = vim.api.nvim_win_get_cursor(0)[1],
+	}
+	return vim.fn.GraniteAnchorTodo(vim.fn.json_encode(ref))
+end
+
+---Change the state of a todo and write it back to its note
+---@param todo Todo|{id: string?, filename: string?, lnum: number?} todo to change, defaults to the todo under the cursor
+---@param state string state name like DONE or a marker like [x]
+---@return string state the new state
+M.set_todo_state = function(todo, state)
+	local ref = {
+		filename = vim.api.nvim_buf_get_name(0),
+		lnum = vim.api.nvim_win_get_cursor(0)[1],
+	}
+	if todo then
+		ref = { id = todo.id, filename = todo.filename, lnum = todo.lnum }
+	end
+	return vim.fn.GraniteSetTodoState(vim.fn.json_encode(ref), state)
+end
+
+---Move a todo to the next state of the state cycle configured in granite.yaml
+---@param todo Todo|{id: string?, filename: string?, lnum: number?}? todo to change, defaults to the todo under the cursor
+---@return string state the new state
+M.cycle_todo_state = function(todo)
+	local ref = {
+		filename = vim.api.nvim_buf_get_name(0),
+		lnum = vim.api.nvim_win_get_cursor(0)[1],
+	}
+	if todo then
+		ref = { id = todo.id, filename = todo.filename, lnum = todo.lnum }
+	end
+	return vim.fn.GraniteCycleTodoState(vim.fn.json_encode(ref))
+end
+
+---Start a clock on a todo, clocks running on other todos are stopped
+---@param todo Todo|{id: string?, filename: string?, lnum: number?}? todo to clock in, defaults to the todo under the cursor
+---@return string start start time of the clock
+M.clock_in = function(todo)
+	local ref = {
+		filename = vim.api.nvim_buf_get_name(0),
+		lnum = vim.api.nvim_win_get_cursor(0)[1],
+	}
+	if todo then
+		ref = { id = todo.id, filename = todo.filename, lnum = todo.lnum }
+	end
+	return vim.fn.GraniteClockIn(vim.fn.json_encode(ref))
+end
+
+---Stop the running clock of a todo
+---@param todo Todo|{id: string?, filename: string?, lnum: number?}? todo to clock out, defaults to all running clocks
+---@return number seconds tracked time of the stopped clocks
+M.clock_out = function(todo)
+	if not todo then
+		return tonumber(vim.fn.GraniteClockOut())
+	end
+	local ref = { id = todo.id, filename = todo.filename, lnum = todo.lnum }
+	return tonumber(vim.fn.GraniteClockOut(vim.fn.json_encode(ref)))
+end
+
+---Sum up tracked time per tag, folder and day
+---@param opts {from: string?, to: string?, tag: string?}? limit the report to clocks started in a date range or todos with a tag
+---@return {total_seconds: number, tags: {[string]: number}, folders: {[string]: number}, dates: {[string]: number}}
+M.clock_report = function(opts)
+	return vim.fn.json_decode(vim.fn.GraniteClockReport(vim.fn.json_encode(opts or vim.empty_dict())))
+end
+
+---@alias Effort {remaining_seconds: number, completed_seconds: number}
+
+---Sum up the estimated work of all todos per tag, note and heading
+---@param opts {tag: string?}? limit the report to a tag
+---@return {total: Effort, tags: {[string]: Effort}, notes: {[string]: Effort}, headings: {[string]: Effort}}
+M.get_effort = function(opts)
+	return vim.fn.json_decode(vim.fn.GraniteGetEffort(vim.fn.json_encode(opts or vim.empty_dict())))
+end
+
+---@class TagNode
+---@field name string Last segment of the tag, eg: alpha for #project/alpha
+---@field tag string Complete tag
+---@field count number Number of todos with the tag or a tag below it
+---@field open number Number of those todos that aren't closed
+---@field children TagNode[]
+
+---Get the hierarchy of all todo tags
+---@return TagNode[]
+M.get_tag_tree = function()
+	return vim.fn.json_decode(vim.fn.GraniteGetTagTree())
+end
+
+---Get everyone mentioned in the vault
+---@return {name: string, mentions: number, notes: number, todos: number, open: number}[]
+M.get_people = function()
+	return vim.fn.json_decode(vim.fn.GraniteGetPeople())
+end
+
+---@class View
+---@field name string
+---@field description string?
+---@field view string? name of the view it builds on
+---@field tag_query string? query of the view and the views it builds on
+---@field states string[]?
+---@field sort string?
+---@field group_by string?
+---@field limit number?
+
+---Get the views defined in granite.yaml, run them with get_all_todos({ view = name })
+---@return View[]
+M.get_views = function()
+	return vim.fn.json_decode(vim.fn.GraniteGetViews())
+end
+
+---Get the dependencies between todos as graphviz dot source
+---@return string dot
+M.get_dependency_graph = function()
+	return vim.fn.GraniteGetDependencyGraph()
+end
+
+---Add a new open todo to a note
+---@param text string text of the todo, the todo tag is added when it's missing
+---@param filename string? note to add the todo to, defaults to the current buffer
+---@param lnum number? line to insert the todo below, defaults to the end of the note
+---@return {filename: string, lnum: number} ref location of the new todo
+M.capture_todo = function(text, filename, lnum)
+	local args = {
+		text = text,
+		filename = filename or vim.api.nvim_buf_get_name(0),
+		lnum = lnum,
+	}
+	return vim.fn.json_decode(vim.fn.GraniteCaptureTodo(vim.fn.json_encode(args)))
+end
+
+---Rewrite relative dates like due:tomorrow in a note into absolute dates
+---@param filename string? note to rewrite, defaults to the current buffer
+---@return number count number of rewritten dates
+M.resolve_dates = function(filename)
+	return tonumber(vim.fn.GraniteResolveDates(filename or vim.api.nvim_buf_get_name(0)))
+end
+
+---Check a tag query for syntax errors
+---@param query string
+---@return {token: string, col: number, message: string}? err what is wrong at which byte column of the query, nil for valid queries
+M.check_query = function(query)
+	local err = vim.fn.json_decode(vim.fn.GraniteCheckQuery(query))
+	if err == vim.NIL then
+		return nil
+	end
+	return err
+end
+
 ---
 ---@param opts any
----@return Todo[]
+---@return Todo[]|{key: string, todos: Todo[]}[] todos grouped by key when grouping with group_by
 M.get_all_todos = function(opts)
 	local json_opts = vim.fn.json_encode(opts)
 	local all_todos = vim.fn.json_decode(vim.fn.GraniteGetTodos(json_opts))
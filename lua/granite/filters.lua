@@ -10,7 +10,7 @@ end
 M.not_done = function(todos)
 	local newTodos = {}
 	for _, todo in pairs(todos) do
-		if todo.state ~= NOTE_STATE.DONE then
+		if not todo.closed then
 			table.insert(newTodos, todo)
 		end
 	end
@@ -23,7 +23,7 @@ end
 M.done = function(todos)
 	local newTodos = {}
 	for _, todo in pairs(todos) do
-		if todo.state == NOTE_STATE.DONE then
+		if todo.closed then
 			table.insert(newTodos, todo)
 		end
 	end
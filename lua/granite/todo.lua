@@ -1,54 +1,94 @@
 local M = {}
 
-local set_table_default = function(table, default)
-	local mt = {
-		__index = function()
-			return default
-		end,
-	}
-	setmetatable(table, mt)
-end
+---@class State
+---@field name string Name of the state, eg: OPEN, DONE, IN_PROGRESS
+---@field markers string[] Markers of the state, the first one is written when a todo changes to it
+---@field closed boolean Whether the state counts as finished
+---@field active boolean Whether todos in the state are being worked on
 
----@enum note_state
-NOTE_STATE = {
-	OPEN = 0,
-	IN_PROGRESS = 1,
-	DONE = 2,
+---States configured in granite.yaml, replaced by set_states once the go host is initialized
+---@type State[]
+M.states = {
+	{ name = "OPEN", markers = { "[ ]", "[]" }, closed = false },
+	{ name = "IN_PROGRESS", markers = { "[/]", "[-]" }, closed = false, active = true },
+	{ name = "DONE", markers = { "[x]", "[X]" }, closed = true },
 }
 
----@type {[note_state]: string}
-STATE_TO_TYPE_CHAR = {
-	[NOTE_STATE.OPEN] = "O",
-	[NOTE_STATE.IN_PROGRESS] = "P",
-	[NOTE_STATE.DONE] = "D",
-}
+---@type {[string]: State}
+local marker_states = {}
 
-STATE_MAP = {
-	["[]"] = NOTE_STATE.OPEN,
-	["[ ]"] = NOTE_STATE.OPEN,
-	["[-]"] = NOTE_STATE.IN_PROGRESS,
-	["[/]"] = NOTE_STATE.IN_PROGRESS,
-	["[x]"] = NOTE_STATE.DONE,
-	["[X]"] = NOTE_STATE.DONE,
-}
-set_table_default(STATE_MAP, NOTE_STATE.OPEN)
+---Use the states configured in granite.yaml to recognize todos
+---@param states State[]
+M.set_states = function(states)
+	M.states = states
+	marker_states = {}
+	for _, state in ipairs(states) do
+		for _, marker in ipairs(state.markers) do
+			marker_states[marker] = state
+		end
+	end
+end
+M.set_states(M.states)
+
+---Find the state marker of a line, like the go host the first [.] of the line
+---@param line string
+---@return State? state
+---@return number? start byte offset of the marker
+local find_state = function(line)
+	-- one character between the brackets, multibyte characters included
+	local start, _, marker = string.find(line, "(%[[^%]]?[\128-\191]*%])")
+	if not marker or not marker_states[marker] then
+		return nil, nil
+	end
+	return marker_states[marker], start
+end
 
 ---@class Todo
 ---@field tags string[] Tags of the todo
----@field due_date string Due date
+---@field due_date string Due date from the due: field
+---@field created_date string? Date of the created: field
+---@field completed_date string? Date of the done: field, stamped when the todo is closed
+---@field clocks {start: string, ["end"]: string?, seconds: number, lnum: number}[]? CLOCK: entries of the todo, newest first
+---@field tracked_seconds number Time of all stopped clocks
+---@field assignees string[]? Names of the people mentioned in the todo, without the @
+---@field estimate_seconds number? Working time of the estimate: field or the ~ shorthand, a day has 8 hours
+---@field effort {remaining_seconds: number, completed_seconds: number} Estimated work of the todo and its subtasks
+---@field heading string? Text of the heading the todo is placed under
+---@field task_id string? Value of the id: field other todos depend on
+---@field depends_on string[]? References of the after: and blocked-by: fields
+---@field blocked boolean Whether a dependency is still open or the todo is part of a cycle
+---@field actionable boolean Whether the todo is open and not blocked
+---@field blocked_by string[]? References of the open dependencies
+---@field dependency_errors string[]? Unknown references, duplicate ids and cycles
+---@field fields {[string]: {type: "date"|"duration"|"number"|"string", raw: string, date: string?, relative: boolean?, base: string?, seconds: number?, number: number?, col: number, end_col: number, value_col: number, value_end_col: number}} Inline key value fields
 ---@field text string Text of the todo
----@field state note_state
+---@field state string Name of the state, eg: OPEN
 ---@field filename string
 ---@field lnum number
----@field type string
+---@field id string Stable identifier, the block anchor or a fingerprint of file and text
+---@field anchor string? Block anchor of the todo without the leading ^
+---@field range {start_byte: number, end_byte: number, lnum: number, col: number, end_lnum: number, end_col: number}
+---@field marker_range {start_byte: number, end_byte: number, lnum: number, col: number, end_lnum: number, end_col: number}
+---@field parent_id string? Id of the parent todo
+---@field end_lnum number? Last line of the todo list item
+---@field body string? Complete list item including continuation lines and nested content
+---@field notes string? Content attached below the first paragraph, without subtasks
+---@field recurrence {raw: string, freq: "daily"|"weekly"|"monthly"|"yearly", interval: number, weekdays: number[]?, month_day: number?, until: string?}? Recurrence rule of the every: or rrule: field
+---@field priority number Priority from 0 (none) to 3 (high)
+---@field urgency number Taskwarrior style urgency score, higher is more urgent
+---@field closed boolean Whether the state counts as finished
+---@field depth number? Number of todos this todo is nested in
+---@field list {lnum: number, end_lnum: number, ordered: boolean}? The list enclosing the todo
+---@field parent_lnum number? Line of the parent todo
+---@field children_lnum number[]? Lines of the direct subtasks
 
 ---Returns weather or not the given line is a todo item line
 ---@param markdown_line string
 ---@param todo_tag string
 ---@return boolean
 M.is_line_todo = function(markdown_line, todo_tag)
-	if string.find(markdown_line, "^.*%[[ -xX]?%]") then
-		if string.find(markdown_line, todo_tag) then
+	if find_state(markdown_line) then
+		if string.find(markdown_line, todo_tag, 1, true) then
 			return true
 		end
 	end
@@ -64,19 +104,17 @@ M.line_to_todo = function(line, todo_tag)
 		return nil
 	end
 	local tags = {}
-	for t in string.gmatch(line, "(#%a+)") do
+	for t in string.gmatch(line, "(#[%w_][%w_/%-]*)") do
 		table.insert(tags, t)
 	end
-	local due_date = string.match(line, "(%d%d%d%d%-%d%d%-%d%d)")
-	local text = string.match(line, "^.*(%[[ -xX]?%].*)$")
-	local stateStr = string.match(line, "^.*(%[[ -xX]?%]).*$")
-	local state = STATE_MAP[stateStr]
+	local due_date = string.match(line, "due::?%s*(%d%d%d%d%-%d%d%-%d%d)")
+	local state, start = find_state(line)
 	return {
 		due_date = due_date,
 		tags = tags,
-		text = text,
-		state = STATE_MAP[stateStr],
-		type = STATE_TO_TYPE_CHAR[state],
+		text = string.sub(line, start),
+		state = state.name,
+		closed = state.closed,
 	}
 end
 
@@ -1,6 +1,7 @@
 local pickers = require("telescope.pickers")
 local finders = require("telescope.finders")
 local conf = require("telescope.config").values
+local previewers = require("telescope.previewers")
 
 local actions = require("telescope.actions")
 local action_state = require("telescope.actions.state")
@@ -30,6 +31,14 @@ return require("telescope").register_extension({
 						end,
 					}),
 					sorter = conf.generic_sorter(opts),
+					previewer = previewers.new_buffer_previewer({
+						title = "todo",
+						define_preview = function(self, entry)
+							local body = entry.value.body or entry.value.text
+							vim.api.nvim_buf_set_lines(self.state.bufnr, 0, -1, false, vim.split(body, "\n"))
+							vim.bo[self.state.bufnr].filetype = "markdown"
+						end,
+					}),
 					attach_mappings = function(prompt_bufnr, map)
 						actions.select_default:replace(function()
 							local selection = action_state.get_selected_entry()
@@ -55,6 +64,10 @@ return require("telescope").register_extension({
 							vim.cmd("vsplit " .. selection.value.filename)
 							vim.cmd(tostring(selection.value.lnum))
 						end)
+						map({ "i", "n" }, "<C-x>", function()
+							local selection = action_state.get_selected_entry()
+							selection.value.state = granite.set_todo_state(selection.value, "DONE")
+						end)
 						return true
 					end,
 				})
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,19 +8,25 @@ import (
 	"fmt"
 	"io/fs"
 	"path"
+	"slices"
 	"strconv"
 	"text/template"
 	"time"
 
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/mrWinston/granite.nvim/pkg/codeblock"
+	"github.com/mrWinston/granite.nvim/pkg/index"
 	"github.com/mrWinston/granite.nvim/pkg/markdown"
 	"github.com/mrWinston/granite.nvim/pkg/models"
+	"github.com/mrWinston/granite.nvim/pkg/notes"
 	"github.com/mrWinston/granite.nvim/pkg/tagquery"
+	"github.com/mrWinston/granite.nvim/pkg/vault"
 	"github.com/neovim/go-client/nvim"
 	"github.com/neovim/go-client/nvim/plugin"
 	log "github.com/sirupsen/logrus"
@@ -35,20 +40,64 @@ var (
 
 const DEFAULT_DATE_FORMAT = "2006-01-02"
 const EXTMARK_NS = "codeblock_run"
+const TODOS_CHANGED_LUA = `vim.api.nvim_exec_autocmds("User", { pattern = "GraniteTodosChanged", data = { files = ... } })`
 
 type Granite struct {
-	ConfigFile string            `json:"config_file" yaml:"config_file"`
-	RootPath   string            `json:"root_path" yaml:"root_path"`
-	TodoTag    string            `json:"todo_tag" yaml:"todo_tag"`
-	logger     *log.Logger       `json:"logger" yaml:"logger"`
-	Templates  []*TemplateConfig `json:"templates" yaml:"templates"`
+	ConfigFile      string                     `json:"config_file" yaml:"config_file"`
+	RootPath        string                     `json:"root_path" yaml:"root_path"`
+	TodoTag         string                     `json:"todo_tag" yaml:"todo_tag"`
+	States          *models.StateConfig        `json:"states" yaml:"states"`
+	PriorityEmoji   map[string]models.Priority `json:"priority_emoji" yaml:"priority_emoji"`
+	Urgency         models.UrgencyCoefficients `json:"urgency" yaml:"urgency"`
+	DateAnchors     []string                   `json:"date_anchors" yaml:"date_anchors"`
+	DailyNoteFormat string                     `json:"daily_note_format" yaml:"daily_note_format"`
+	StampCreated    bool                       `json:"stamp_created" yaml:"stamp_created"`
+	Views           map[string]*View           `json:"views" yaml:"views"`
+	logger          *log.Logger
+	Templates       []*TemplateConfig `json:"templates" yaml:"templates"`
+	index           *index.Index
+	rules           *vault.Rules
+	stopWatch       context.CancelFunc
+	scansMu         sync.Mutex
+	scans           map[string]*scan
+}
+
+// scan is a running vault scan that can be superseded by a newer one
+type scan struct {
+	cancel context.CancelFunc
 }
 
 type GetTodosArgs struct {
-	States   []string `json:"states,omitempty" yaml:"states,omitempty"`
-	Tag      string   `json:"tag,omitempty" yaml:"tag,omitempty"`
-	TagQuery string   `json:"tag_query,omitempty" yaml:"tag_query,omitempty"`
-	Due      string   `json:"due,omitempty" yaml:"due,omitempty"`
+	// View starts from the arguments of the view with this name, see View
+	View   string   `json:"view,omitempty" yaml:"view,omitempty"`
+	States []string `json:"states,omitempty" yaml:"states,omitempty"`
+	// Closed limits the todos to closed (true) or not closed (false) states
+	Closed *bool `json:"closed,omitempty" yaml:"closed,omitempty"`
+	// Tag limits the todos to those with a tag matching this pattern. With a
+	// TagQuery both have to match.
+	Tag      string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	TagQuery string `json:"tag_query,omitempty" yaml:"tag_query,omitempty"`
+	Due      string `json:"due,omitempty" yaml:"due,omitempty"`
+	// Assignee limits the todos to those assigned to this person, with or
+	// without the leading @. Subtasks of an assigned todo only match when
+	// they mention the person themselves.
+	Assignee string `json:"assignee,omitempty" yaml:"assignee,omitempty"`
+	// Blocked limits the todos to blocked (true) or not blocked (false) ones
+	Blocked *bool `json:"blocked,omitempty" yaml:"blocked,omitempty"`
+	// Actionable limits the todos to open todos that aren't blocked (true) or the rest (false)
+	Actionable *bool `json:"actionable,omitempty" yaml:"actionable,omitempty"`
+	// CompletedFrom and CompletedTo limit the todos to those completed in
+	// this range of dates, both ends included
+	CompletedFrom string `json:"completed_from,omitempty" yaml:"completed_from,omitempty"`
+	CompletedTo   string `json:"completed_to,omitempty" yaml:"completed_to,omitempty"`
+	// Sort orders the todos by urgency, due, priority, file or state
+	Sort string `json:"sort,omitempty" yaml:"sort,omitempty"`
+	// GroupBy returns the todos as models.TodoGroup list grouped by state,
+	// tag, file, heading, assignee, priority or due
+	GroupBy string `json:"group_by,omitempty" yaml:"group_by,omitempty"`
+	// Limit caps the number of returned todos, applied after sorting. When
+	// grouping it caps the todos of each group.
+	Limit int `json:"limit,omitempty" yaml:"limit,omitempty"`
 }
 
 func newTemplate(name string) *template.Template {
@@ -62,38 +111,63 @@ func newTemplate(name string) *template.Template {
 	return t
 }
 
-func (g *Granite) FilterTodos(todos []*models.Todo, query string) ([]*models.Todo, error) {
-	result := []*models.Todo{}
-	// ( tag OR bla ) AND todo
-
-	// split query into tokens
-	// replace all tag tokens with the list of todos
-	// aggregate list from inside out with AND and OR
-
-	tokens := tagquery.QueryToTokens(query)
-	g.logger.Infof("Got Tokens: [%s]", strings.Join(tokens, ","))
-	tree, err := tagquery.BuildTokenTree(tokens)
+// FilterTodos returns the todos of idx matching query, see tagquery.Parse
+// for its syntax. Relative dates in the query are resolved against today.
+// Syntax errors are returned as *tagquery.QueryError.
+func (g *Granite) FilterTodos(idx *tagquery.Index, query string) ([]*models.Todo, error) {
+	env := g.queryEnv(time.Now())
+	tree, err := tagquery.ParseWith(query, env)
 	if err != nil {
-		return result, err
+		return []*models.Todo{}, err
 	}
 
 	g.logger.Infof("Got Tree: %s", tree)
 
-	return tree.GetTodos(func(s string) []*models.Todo {
-		return Filter(todos, func(element *models.Todo) bool {
-			compare, negate := strings.CutPrefix(s, "!")
-			contains := strings.Contains(strings.Join(element.Tags, ","), compare)
+	return tree.Execute(idx, env)
+}
 
-			if negate {
-				return !contains
-			} else {
-				return contains
-			}
-		})
-	}), nil
+// queryIndex returns the tagquery index of todos as returned by
+// GetCurrentTodos. The index is shared with g.index until a note changes;
+// only unsaved buffers have their todos indexed for every query.
+func (g *Granite) queryIndex(todos []*models.Todo) *tagquery.Index {
+	idx := g.index.QueryIndex()
+	if idx.Indexes(todos) {
+		return idx
+	}
+	return tagquery.NewIndex(todos)
+}
+
+// queryEnv returns what the predicates of tag queries are evaluated against
+func (g *Granite) queryEnv(now time.Time) tagquery.Env {
+	return tagquery.Env{
+		Now:    now,
+		States: g.States,
+		Root:   g.RootPath,
+	}
+}
+
+// CheckQuery parses the tag query in args[0] and returns the json encoded
+// tagquery.QueryError describing what is wrong with it, or null for valid
+// queries
+func (g *Granite) CheckQuery(v *nvim.Nvim, args []string) (string, error) {
+	g.logger.Debugf("Called CheckQuery with args: %v", args)
+	if len(args) != 1 {
+		g.logger.Errorf("CheckQuery expects exactly 1 argument.")
+		return "", fmt.Errorf("CheckQuery expects exactly 1 argument.")
+	}
+	_, err := tagquery.ParseWith(args[0], g.queryEnv(time.Now()))
+	queryErr := &tagquery.QueryError{}
+	if err != nil && !errors.As(err, &queryErr) {
+		return "", err
+	}
+	if err == nil {
+		queryErr = nil
+	}
+	rawJson, err := json.Marshal(queryErr)
+	return string(rawJson), err
 }
 
-func (g *Granite) GetTodos(args []string) (string, error) {
+func (g *Granite) GetTodos(v *nvim.Nvim, args []string) (string, error) {
 	g.logger.Debugf("Called GetTodos with args: %v", args)
 	if len(args) != 1 {
 		g.logger.Errorf("GetTodos expects exactly 1 argument.")
@@ -106,29 +180,78 @@ func (g *Granite) GetTodos(args []string) (string, error) {
 		g.logger.Warnf("Error parsing args for GetTodos: %v", err)
 	}
 
-	todos, err := g.GetAllTodos()
+	if getArgs.View != "" {
+		view, err := g.resolveView(getArgs.View, nil)
+		if err != nil {
+			g.logger.Errorf("Invalid view: %v", err)
+			return "", fmt.Errorf("Invalid view: %w", err)
+		}
+		merged := mergeTodosArgs(view, *getArgs)
+		getArgs = &merged
+	}
+
+	ctx, done := g.supersede("GetTodos")
+	defer done()
+
+	current, err := g.GetCurrentTodos(ctx, v)
 	if err != nil {
 		g.logger.Errorf("Error getting todos from markdown files: %v", err)
 		return "", fmt.Errorf("Error getting todos from markdown files: %w", err)
 	}
+	todos := g.prepareTodos(current, time.Now())
 
-	if len(getArgs.States) > 0 {
-		getargsstatetmp := strings.Join(getArgs.States, ",")
-		todos = Filter[*models.Todo](todos, func(element *models.Todo) bool {
-			return strings.Contains(getargsstatetmp, element.StateString)
-		})
-	}
-
+	// the query runs on the index of all todos, so it comes first
 	if getArgs.TagQuery != "" {
-		todos, err = g.FilterTodos(todos, getArgs.TagQuery)
+		todos, err = g.FilterTodos(g.queryIndex(current).With(todos), getArgs.TagQuery)
 		if err != nil {
 			g.logger.Errorf("Error Getting todos from Query: %v", err)
 			return "", fmt.Errorf("Error Getting todos from Query: %w", err)
 		}
-	} else if getArgs.Tag != "" {
+	}
+	if getArgs.Tag != "" {
+		pattern, err := g.parseTagFilter(getArgs.Tag)
+		if err != nil {
+			return "", err
+		}
+		todos = Filter[*models.Todo](todos, pattern.MatchTodo)
+	}
+
+	if len(getArgs.States) > 0 {
+		states := map[string]bool{}
+		for _, name := range getArgs.States {
+			state, err := g.States.Resolve(name)
+			if err != nil {
+				g.logger.Errorf("Invalid state filter: %v", err)
+				return "", fmt.Errorf("Invalid state filter: %w", err)
+			}
+			states[state.Name] = true
+		}
 		todos = Filter[*models.Todo](todos, func(element *models.Todo) bool {
-			g.logger.Errorf("%v", element.Tags)
-			return strings.Contains(strings.Join(element.Tags, ","), getArgs.Tag)
+			return states[element.StateString]
+		})
+	}
+
+	if getArgs.Closed != nil {
+		todos = Filter[*models.Todo](todos, func(element *models.Todo) bool {
+			return element.Closed == *getArgs.Closed
+		})
+	}
+
+	if getArgs.Assignee != "" {
+		todos = Filter[*models.Todo](todos, func(element *models.Todo) bool {
+			return element.HasAssignee(getArgs.Assignee)
+		})
+	}
+
+	if getArgs.Blocked != nil {
+		todos = Filter[*models.Todo](todos, func(element *models.Todo) bool {
+			return element.Blocked == *getArgs.Blocked
+		})
+	}
+
+	if getArgs.Actionable != nil {
+		todos = Filter[*models.Todo](todos, func(element *models.Todo) bool {
+			return element.Actionable == *getArgs.Actionable
 		})
 	}
 
@@ -149,11 +272,81 @@ func (g *Granite) GetTodos(args []string) (string, error) {
 		})
 	}
 
+	if getArgs.CompletedFrom != "" || getArgs.CompletedTo != "" {
+		for _, date := range []string{getArgs.CompletedFrom, getArgs.CompletedTo} {
+			if _, err := time.Parse(DEFAULT_DATE_FORMAT, date); date != "" && err != nil {
+				g.logger.Errorf("Cannot parse completion date '%s' : %v", date, err)
+				return "", fmt.Errorf("Cannot parse completion date '%s' : %w", date, err)
+			}
+		}
+
+		// dates are YYYY-MM-DD, so they compare as strings
+		todos = Filter[*models.Todo](todos, func(element *models.Todo) bool {
+			if element.CompletedDate == "" {
+				return false
+			}
+			if getArgs.CompletedFrom != "" && element.CompletedDate < getArgs.CompletedFrom {
+				return false
+			}
+			return getArgs.CompletedTo == "" || element.CompletedDate <= getArgs.CompletedTo
+		})
+	}
+
+	if getArgs.Sort != "" {
+		err = models.SortTodos(todos, getArgs.Sort, g.States)
+		if err != nil {
+			g.logger.Errorf("Invalid sort order: %v", err)
+			return "", fmt.Errorf("Invalid sort order: %w", err)
+		}
+	}
+	if getArgs.GroupBy != "" {
+		groups, err := models.GroupTodos(todos, getArgs.GroupBy, g.RootPath, g.TodoTag)
+		if err != nil {
+			g.logger.Errorf("Invalid grouping: %v", err)
+			return "", fmt.Errorf("Invalid grouping: %w", err)
+		}
+		for _, group := range groups {
+			if getArgs.Limit > 0 && len(group.Todos) > getArgs.Limit {
+				group.Todos = group.Todos[:getArgs.Limit]
+			}
+		}
+		rawJson, err := json.Marshal(groups)
+		return string(rawJson), err
+	}
+
+	if getArgs.Limit > 0 && len(todos) > getArgs.Limit {
+		todos = todos[:getArgs.Limit]
+	}
+
 	rawJson, err := json.Marshal(todos)
 
 	return string(rawJson), err
 }
 
+// prepareTodos returns copies of todos with the values that depend on the
+// current date or on other notes: relative dates of notes anchored on today
+// are resolved, the urgency is computed and dependencies are resolved. The
+// todos themselves are shared with the index and stay untouched.
+func (g *Granite) prepareTodos(todos []*models.Todo, now time.Time) []*models.Todo {
+	resolveToday := slices.Contains(g.DateAnchors, notes.ANCHOR_TODAY)
+	prepared := make([]*models.Todo, len(todos))
+	for i, todo := range todos {
+		c := *todo
+		if resolveToday && c.HasUnresolvedDates() {
+			c.Fields = map[string]*models.Field{}
+			for key, field := range todo.Fields {
+				f := *field
+				c.Fields[key] = &f
+			}
+			c.ResolveDates(now)
+		}
+		c.Urgency = c.UrgencyAt(now, g.Urgency, g.States)
+		prepared[i] = &c
+	}
+	models.ResolveDependencies(prepared)
+	return prepared
+}
+
 func Filter[T any](elements []T, filterFunc func(element T) bool) []T {
 	n := []T{}
 	for _, v := range elements {
@@ -164,20 +357,39 @@ func Filter[T any](elements []T, filterFunc func(element T) bool) []T {
 	return n
 }
 
+// parseTagFilter parses the tag filter of a request, nil without one
+func (g *Granite) parseTagFilter(tag string) (*tagquery.Pattern, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	pattern, err := tagquery.ParsePattern(tag)
+	if err != nil {
+		g.logger.Errorf("Invalid tag filter: %v", err)
+		return nil, fmt.Errorf("Invalid tag filter: %w", err)
+	}
+	return pattern, nil
+}
+
 func (g *Granite) GetAllTodosWithTag(tag string) ([]*models.Todo, error) {
-	allTodos, err := g.GetAllTodos()
+	allTodos, err := g.GetAllTodos(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	filteredTodos := Filter[*models.Todo](allTodos, func(element *models.Todo) bool {
-		return strings.Contains(strings.Join(element.Tags, ","), tag)
-	})
+	pattern, err := tagquery.ParsePattern(tag)
+	if err != nil {
+		return nil, err
+	}
+	allTodos = g.prepareTodos(allTodos, time.Now())
+	filteredTodos := Filter[*models.Todo](allTodos, pattern.MatchTodo)
 
 	return filteredTodos, nil
 }
 
-func (g *Granite) GetAllTags() ([]string, error) {
-	todos, err := g.GetAllTodos()
+func (g *Granite) GetAllTags(v *nvim.Nvim) ([]string, error) {
+	ctx, done := g.supersede("GetAllTags")
+	defer done()
+
+	todos, err := g.GetCurrentTodos(ctx, v)
 	if err != nil {
 		g.logger.Errorf("Error getting todos from markdown files: %v", err)
 		return nil, fmt.Errorf("Error getting todos from markdown files: %w", err)
@@ -198,72 +410,207 @@ func (g *Granite) GetAllTags() ([]string, error) {
 	return allTags, nil
 }
 
-func (g *Granite) GetAllTodos() ([]*models.Todo, error) {
+// GetTagTree returns the hierarchy of all todo tags as json encoded
+// models.TagNode list, with the number of todos below every tag
+func (g *Granite) GetTagTree(v *nvim.Nvim) (string, error) {
+	ctx, done := g.supersede("GetTagTree")
+	defer done()
+
+	todos, err := g.GetCurrentTodos(ctx, v)
+	if err != nil {
+		g.logger.Errorf("Error getting todos from markdown files: %v", err)
+		return "", fmt.Errorf("Error getting todos from markdown files: %w", err)
+	}
+
+	rawJson, err := json.Marshal(models.BuildTagTree(todos))
+	return string(rawJson), err
+}
+
+// GetPeople returns everyone mentioned in the vault as json encoded
+// models.Person list, with the number of mentions and assigned todos
+func (g *Granite) GetPeople(v *nvim.Nvim) (string, error) {
+	ctx, done := g.supersede("GetPeople")
+	defer done()
+
+	notes, err := g.GetCurrentNotes(ctx, v)
+	if err != nil {
+		g.logger.Errorf("Error getting notes from markdown files: %v", err)
+		return "", fmt.Errorf("Error getting notes from markdown files: %w", err)
+	}
+
+	rawJson, err := json.Marshal(models.BuildPeople(notes))
+	return string(rawJson), err
+}
+
+// GetDependencyGraph returns the dependencies between all todos in the
+// graphviz dot language. Unknown references and cycles are listed as
+// comments.
+func (g *Granite) GetDependencyGraph(v *nvim.Nvim) (string, error) {
+	ctx, done := g.supersede("GetDependencyGraph")
+	defer done()
+
+	todos, err := g.GetCurrentTodos(ctx, v)
+	if err != nil {
+		g.logger.Errorf("Error getting todos from markdown files: %v", err)
+		return "", fmt.Errorf("Error getting todos from markdown files: %w", err)
+	}
+
+	todos = g.prepareTodos(todos, time.Now())
+	return models.ResolveDependencies(todos).DOT(), nil
+}
+
+// supersede returns a context for a scan started by the handler called name.
+// Starting another scan for the same handler cancels the previous one, so a
+// request nobody waits for anymore stops early. done must be called once the
+// scan is finished.
+func (g *Granite) supersede(name string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	g.scansMu.Lock()
+	defer g.scansMu.Unlock()
+	if g.scans == nil {
+		g.scans = map[string]*scan{}
+	}
+	if previous, ok := g.scans[name]; ok {
+		previous.cancel()
+	}
+	current := &scan{cancel: cancel}
+	g.scans[name] = current
+
+	return ctx, func() {
+		cancel()
+		g.scansMu.Lock()
+		defer g.scansMu.Unlock()
+		if g.scans[name] == current {
+			delete(g.scans, name)
+		}
+	}
+}
+
+func (g *Granite) GetAllTodos(ctx context.Context) ([]*models.Todo, error) {
 
-	mdFiles, err := GetAllFilesWithExtInDir(g.RootPath, ".md")
+	mdFiles, err := g.rules.Notes(ctx)
 
 	if err != nil {
 		g.logger.Errorf("Error Reading markdown files: %v", err)
 		return nil, fmt.Errorf("Error Reading markdown files: %w", err)
 	}
 
-	todos := []*models.Todo{}
+	err = g.index.Refresh(ctx, mdFiles)
+	if ctx.Err() != nil {
+		g.logger.Infof("Scan of %s was superseded: %v", g.RootPath, err)
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		g.logger.Warnf("Error refreshing index, some files were skipped: %v", err)
+	}
 
-	for _, mdFilePath := range mdFiles {
-		mdFile, err := os.Open(mdFilePath)
-		if err != nil {
-			g.logger.Warnf("Error opening file %s for reading: %v. Skipping.", mdFilePath, err)
-			continue
-		}
-		scanner := bufio.NewScanner(mdFile)
-		scanner.Split(bufio.ScanLines)
-		lineNumber := 1
-		if !scanner.Scan() {
-			g.logger.Infof("Scanning finished prematurely: %s", mdFilePath)
-			continue
-		}
-		for line := scanner.Text(); scanner.Scan(); line = scanner.Text() {
-			if strings.Contains(line, g.TodoTag) {
-				t := &models.Todo{
-					RawLine:    line,
-					LineNumber: lineNumber,
-					FilePath:   mdFilePath,
-				}
-				err := t.Parse()
-				if err == nil {
-					todos = append(todos, t)
-				} else {
-					g.logger.Infof("Error parsing Log Line '%s': %v", line, err)
-				}
-			}
-			lineNumber++
-		}
+	err = g.index.Save()
+	if err != nil {
+		g.logger.Warnf("Error saving index: %v", err)
 	}
 
+	return g.index.Todos(), nil
+}
+
+// GetCurrentTodos returns the todos of all notes like GetAllTodos, but
+// notes with unsaved changes in neovim contribute the todos of their buffer
+// instead of the file on disk
+func (g *Granite) GetCurrentTodos(ctx context.Context, v *nvim.Nvim) ([]*models.Todo, error) {
+	notes, err := g.GetCurrentNotes(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	todos := []*models.Todo{}
+	for _, note := range notes {
+		todos = append(todos, note.Todos...)
+	}
 	return todos, nil
+}
+
+// GetCurrentNotes returns all notes sorted by path. Notes with unsaved
+// changes in neovim are parsed from their buffer instead of the file on disk.
+func (g *Granite) GetCurrentNotes(ctx context.Context, v *nvim.Nvim) ([]*models.Note, error) {
+	_, err := g.GetAllTodos(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	overlay, err := g.ModifiedNotes(v)
+	if err != nil {
+		g.logger.Warnf("Ignoring unsaved buffers: %v", err)
+	}
+
+	notes := g.index.Notes()
+	for i, note := range notes {
+		if modified, ok := overlay[note.Path]; ok {
+			notes[i] = modified
+			delete(overlay, note.Path)
+		}
+	}
+	// buffers of notes that were never written
+	for _, note := range overlay {
+		notes = append(notes, note)
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].Path < notes[j].Path
+	})
+	return notes, nil
 }
 
-func GetAllFilesWithExtInDir(dir string, ext string) ([]string, error) {
-	foundFiles := []string{}
-	err := filepath.Walk(dir,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+// ParseNote extracts all todos from the content of the markdown file at
+// mdFilePath
+func (g *Granite) ParseNote(mdFilePath string, content []byte) (*models.Note, error) {
+	return notes.Parse(mdFilePath, content, notes.Options{
+		TodoTag:         g.TodoTag,
+		States:          g.States,
+		PriorityEmoji:   g.PriorityEmoji,
+		DateAnchors:     g.DateAnchors,
+		DailyNoteFormat: g.DailyNoteFormat,
+	})
+}
 
-			if info.IsDir() {
-				return nil
-			}
+// indexKey identifies the configuration that influences parsing. Cached
+// notes parsed with another configuration are thrown away.
+func (g *Granite) indexKey() string {
+	states, _ := json.Marshal(g.States)
+	emoji, _ := json.Marshal(g.PriorityEmoji)
+	return strings.Join([]string{
+		g.TodoTag,
+		string(states),
+		string(emoji),
+		strings.Join(g.DateAnchors, ","),
+		g.DailyNoteFormat,
+	}, "\x00")
+}
 
-			if !strings.HasSuffix(path, ext) {
-				return nil
-			}
-			foundFiles = append(foundFiles, path)
-			return nil
-		})
+// Watch keeps the index up to date while ctx is active and fires the
+// `User GraniteTodosChanged` autocommand in neovim whenever the todos of a
+// note change. The autocommand data holds the changed files as `files`.
+func (g *Granite) Watch(ctx context.Context, v *nvim.Nvim) {
+	// warm up the index so the first query doesn't have to
+	_, err := g.GetAllTodos(ctx)
+	if err != nil {
+		g.logger.Warnf("Error building initial index: %v", err)
+	}
 
-	return foundFiles, err
+	watcher := index.NewWatcher(g.index, g.RootPath, g.rules)
+	watcher.OnError = func(err error) {
+		g.logger.Warnf("Error while watching %s: %v", g.RootPath, err)
+	}
+	watcher.OnChange = func(paths []string) {
+		g.logger.Debugf("Todos changed in files: %v", paths)
+		err := v.ExecLua(TODOS_CHANGED_LUA, nil, paths)
+		if err != nil {
+			g.logger.Errorf("Unable to notify neovim about changed todos: %v", err)
+		}
+	}
+
+	err = watcher.Run(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		g.logger.Errorf("Stopped watching %s: %v", g.RootPath, err)
+	}
 }
 
 type TemplateParameter struct {
@@ -380,6 +727,13 @@ func (g *Granite) GetTemplates(args []string) (string, error) {
 	return string(b), err
 }
 
+// GetStates returns the json encoded models.StateConfig of granite.yaml, so
+// the lua side recognizes the same markers
+func (g *Granite) GetStates(args []string) (string, error) {
+	b, err := json.Marshal(g.States)
+	return string(b), err
+}
+
 type InitArgs struct {
 	GraniteYaml string `json:"granite_yaml" yaml:"granite_yaml"`
 	LogLevel    string `json:",omitempty" yaml:"log_level"`
@@ -388,6 +742,33 @@ type InitArgs struct {
 type GraniteConfig struct {
 	Templates []*TemplateConfig `json:"templates" yaml:"templates"`
 	TodoTag   string            `json:"todotag" yaml:"todotag"`
+	// Extensions of files treated as notes, defaults to vault.DefaultExtensions
+	Extensions []string `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+	// Include limits the notes to files matching one of these gitignore style patterns
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+	// Exclude are gitignore style patterns of files that aren't notes,
+	// defaults to vault.DefaultExclude
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	// States of todos, defaults to models.DefaultStates
+	States []*models.State `json:"states,omitempty" yaml:"states,omitempty"`
+	// StateCycle is the order states are toggled through, defaults to the order of States
+	StateCycle []string `json:"state_cycle,omitempty" yaml:"state_cycle,omitempty"`
+	// PriorityEmoji maps emoji to the priority they mark (high, medium or
+	// low), defaults to models.DefaultPriorityEmoji
+	PriorityEmoji map[string]string `json:"priority_emoji,omitempty" yaml:"priority_emoji,omitempty"`
+	// Urgency overrides the coefficients of the urgency score, defaults to models.DefaultUrgency
+	Urgency models.UrgencyCoefficients `json:"urgency,omitempty" yaml:"urgency,omitempty"`
+	// DateAnchors are tried in order to find the date relative dates like
+	// due:tomorrow are resolved against, defaults to notes.DefaultDateAnchors
+	DateAnchors []string `json:"date_anchors,omitempty" yaml:"date_anchors,omitempty"`
+	// DailyNoteFormat is the go time layout of daily note file names,
+	// defaults to notes.DefaultDailyNoteFormat
+	DailyNoteFormat string `json:"daily_note_format,omitempty" yaml:"daily_note_format,omitempty"`
+	// StampCreated adds a created: field with the current date to captured todos
+	StampCreated bool `json:"stamp_created,omitempty" yaml:"stamp_created,omitempty"`
+	// Views are named todo queries that can be run by name through
+	// GetTodos, see View
+	Views map[string]*View `json:"views,omitempty" yaml:"views,omitempty"`
 }
 
 func Must[T any](val T, err error) T {
@@ -397,7 +778,7 @@ func Must[T any](val T, err error) T {
 	return val
 }
 
-func (g *Granite) Init(args []string) (string, error) {
+func (g *Granite) Init(v *nvim.Nvim, args []string) (string, error) {
 	g.logger.Infof("Called Init with args: %v", args)
 
 	if len(args) != 1 {
@@ -433,7 +814,7 @@ func (g *Granite) Init(args []string) (string, error) {
 		return "", err
 	}
 
-	graniteConf := &GraniteConfig{}
+	graniteConf := &GraniteConfig{Urgency: models.DefaultUrgency}
 	err = yaml.Unmarshal(configRaw, graniteConf)
 	g.logger.Infof("Unmarshalled conf, err: %v", err)
 	if err != nil {
@@ -444,7 +825,84 @@ func (g *Granite) Init(args []string) (string, error) {
 	g.TodoTag = graniteConf.TodoTag
 	g.Templates = graniteConf.Templates
 
+	g.States, err = models.NewStateConfig(graniteConf.States, graniteConf.StateCycle)
+	if err != nil {
+		g.logger.Errorf("Invalid todo states in config: %v", err)
+		return "", fmt.Errorf("Invalid todo states in config: %w", err)
+	}
+
+	g.PriorityEmoji = models.DefaultPriorityEmoji
+	if graniteConf.PriorityEmoji != nil {
+		g.PriorityEmoji = map[string]models.Priority{}
+		for emoji, name := range graniteConf.PriorityEmoji {
+			g.PriorityEmoji[emoji], err = models.ParsePriority(name)
+			if err != nil {
+				g.logger.Errorf("Invalid priority emoji in config: %v", err)
+				return "", fmt.Errorf("Invalid priority emoji in config: %w", err)
+			}
+		}
+	}
+	g.Urgency = graniteConf.Urgency
+
+	g.DateAnchors = notes.DefaultDateAnchors
+	if graniteConf.DateAnchors != nil {
+		g.DateAnchors = graniteConf.DateAnchors
+	}
+	err = notes.ValidateDateAnchors(g.DateAnchors)
+	if err != nil {
+		g.logger.Errorf("Invalid date anchors in config: %v", err)
+		return "", fmt.Errorf("Invalid date anchors in config: %w", err)
+	}
+	g.DailyNoteFormat = notes.DefaultDailyNoteFormat
+	if graniteConf.DailyNoteFormat != "" {
+		g.DailyNoteFormat = graniteConf.DailyNoteFormat
+	}
+	g.StampCreated = graniteConf.StampCreated
+
 	g.RootPath = filepath.Dir(g.ConfigFile)
+
+	g.Views = map[string]*View{}
+	for name, view := range graniteConf.Views {
+		if view == nil {
+			view = &View{}
+		}
+		view.Name = name
+		g.Views[name] = view
+	}
+	err = g.checkViews()
+	if err != nil {
+		g.logger.Errorf("Invalid views in config: %v", err)
+		return "", fmt.Errorf("Invalid views in config: %w", err)
+	}
+
+	g.rules, err = vault.NewRules(g.RootPath, vault.Config{
+		Extensions: graniteConf.Extensions,
+		Include:    graniteConf.Include,
+		Exclude:    graniteConf.Exclude,
+	})
+	if err != nil {
+		g.logger.Errorf("Invalid file patterns in config: %v", err)
+		return "", fmt.Errorf("Invalid file patterns in config: %w", err)
+	}
+
+	cachePath, err := index.DefaultCachePath(g.RootPath)
+	if err != nil {
+		g.logger.Errorf("Unable to determine index cache path: %v", err)
+		return "", fmt.Errorf("Unable to determine index cache path: %w", err)
+	}
+	g.index = index.New(cachePath, g.indexKey(), g.ParseNote)
+	err = g.index.Load()
+	if err != nil {
+		g.logger.Warnf("Ignoring unreadable index cache %s: %v", cachePath, err)
+	}
+
+	if g.stopWatch != nil {
+		g.stopWatch()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	g.stopWatch = cancel
+	go g.Watch(ctx, v)
+
 	g.logger.Info("All Done in init")
 
 	return "Called Init", nil
@@ -734,16 +1192,34 @@ func main() {
 
 	defer f.Close()
 	g := &Granite{
-		logger: graniteLogger,
+		logger:        graniteLogger,
+		States:        models.DefaultStateConfig,
+		PriorityEmoji: models.DefaultPriorityEmoji,
+		Urgency:       models.DefaultUrgency,
 	}
 
 	g.logger.Println("Logger init done")
 	plugin.Main(func(p *plugin.Plugin) error {
 		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteRunCodeblock"}, g.RunCodeblock)
 		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetTodos"}, g.GetTodos)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteCheckQuery"}, g.CheckQuery)
 		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetAllTags"}, g.GetAllTags)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetTagTree"}, g.GetTagTree)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetDependencyGraph"}, g.GetDependencyGraph)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetEffort"}, g.GetEffort)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetPeople"}, g.GetPeople)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetStates"}, g.GetStates)
 		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetTemplates"}, g.GetTemplates)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteGetViews"}, g.GetViews)
 		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteRenderTemplate"}, g.RenderTemplate)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteAnchorTodo"}, g.AnchorTodo)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteSetTodoState"}, g.SetTodoState)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteCycleTodoState"}, g.CycleTodoState)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteResolveDates"}, g.ResolveDates)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteCaptureTodo"}, g.CaptureTodo)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteClockIn"}, g.ClockIn)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteClockOut"}, g.ClockOut)
+		p.HandleFunction(&plugin.FunctionOptions{Name: "GraniteClockReport"}, g.ClockReport)
 		p.HandleFunction(&plugin.FunctionOptions{
 			Name: "GraniteInit",
 		}, g.Init)
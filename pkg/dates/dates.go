@@ -0,0 +1,102 @@
+// Package dates resolves relative date expressions like tomorrow, fri, +3d
+// or next-month against a base date
+package dates
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FORMAT is the format of resolved dates
+const FORMAT = "2006-01-02"
+
+// offsetRegex matches offsets like +3d, -1w, +2m or +1y
+var offsetRegex = regexp.MustCompile(`^([+-]\d+)([dwmy])$`)
+
+// chainRegex matches expressions followed by an offset, like today+7d or
+// fri-1d
+var chainRegex = regexp.MustCompile(`^(.+?)([+-]\d+[dwmy])$`)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Resolve returns the date expr refers to, relative to base. Supported are
+// today, tomorrow, yesterday, weekday names (fri, friday or next-fri, the
+// next such day after base), offsets (+3d, -1w, +2m, +1y) and next-week,
+// next-month and next-year, the first day of the following period with
+// weeks starting on monday. Any of them can be followed by an offset, like
+// today+7d or next-month-1d. ok is false when expr isn't a relative date.
+func Resolve(expr string, base time.Time) (date time.Time, ok bool) {
+	base = Day(base)
+	expr = strings.ToLower(strings.TrimSpace(expr))
+
+	if m := chainRegex.FindStringSubmatch(expr); m != nil {
+		if start, ok := Resolve(m[1], base); ok {
+			return Resolve(m[2], start)
+		}
+	}
+
+	switch expr {
+	case "today":
+		return base, true
+	case "tomorrow":
+		return base.AddDate(0, 0, 1), true
+	case "yesterday":
+		return base.AddDate(0, 0, -1), true
+	case "next-week":
+		daysSinceMonday := (int(base.Weekday()) + 6) % 7
+		return base.AddDate(0, 0, 7-daysSinceMonday), true
+	case "next-month":
+		return time.Date(base.Year(), base.Month()+1, 1, 0, 0, 0, 0, time.UTC), true
+	case "next-year":
+		return time.Date(base.Year()+1, 1, 1, 0, 0, 0, 0, time.UTC), true
+	}
+
+	if day, found := weekdays[strings.TrimPrefix(expr, "next-")]; found {
+		diff := (int(day) - int(base.Weekday()) + 7) % 7
+		if diff == 0 {
+			diff = 7
+		}
+		return base.AddDate(0, 0, diff), true
+	}
+
+	if m := offsetRegex.FindStringSubmatch(expr); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, false
+		}
+		switch m[2] {
+		case "d":
+			return base.AddDate(0, 0, n), true
+		case "w":
+			return base.AddDate(0, 0, 7*n), true
+		case "m":
+			return base.AddDate(0, n, 0), true
+		case "y":
+			return base.AddDate(n, 0, 0), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// IsRelative reports whether expr is a relative date Resolve understands
+func IsRelative(expr string) bool {
+	_, ok := Resolve(expr, time.Now())
+	return ok
+}
+
+// Day returns the calendar day of t as midnight UTC, so days can be compared
+// and formatted independent of the time zone
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
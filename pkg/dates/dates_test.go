@@ -0,0 +1,47 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	// a wednesday
+	base := time.Date(2024, 5, 15, 18, 30, 0, 0, time.Local)
+
+	tests := map[string]string{
+		"today":         "2024-05-15",
+		"tomorrow":      "2024-05-16",
+		"Yesterday":     "2024-05-14",
+		"fri":           "2024-05-17",
+		"friday":        "2024-05-17",
+		"wed":           "2024-05-22",
+		"next-mon":      "2024-05-20",
+		"+3d":           "2024-05-18",
+		"-1w":           "2024-05-08",
+		"+2m":           "2024-07-15",
+		"+1y":           "2025-05-15",
+		"next-week":     "2024-05-20",
+		"next-month":    "2024-06-01",
+		"next-year":     "2025-01-01",
+		"today+7d":      "2024-05-22",
+		"fri-1d":        "2024-05-16",
+		"next-month-1d": "2024-05-31",
+	}
+	for expr, want := range tests {
+		date, ok := Resolve(expr, base)
+		if !ok {
+			t.Errorf("Resolve(%q) is not a relative date", expr)
+			continue
+		}
+		if got := date.Format(FORMAT); got != want {
+			t.Errorf("Resolve(%q) = %s, want %s", expr, got, want)
+		}
+	}
+
+	for _, expr := range []string{"2024-05-01", "high", "3d", "next", "+d", "2024-05-01+3d", "soon+1d"} {
+		if _, ok := Resolve(expr, base); ok {
+			t.Errorf("Resolve(%q) took it for a relative date", expr)
+		}
+	}
+}
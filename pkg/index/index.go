@@ -0,0 +1,442 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+	"github.com/mrWinston/granite.nvim/pkg/tagquery"
+)
+
+// VERSION is stored alongside the cached entries. Bump it whenever the
+// serialized shape of models.Note changes so stale caches get discarded.
+const VERSION = 18
+
+// ParseFunc turns the content of a single file into a note
+type ParseFunc func(path string, content []byte) (*models.Note, error)
+
+// Entry is the cached state of a single file in the vault
+type Entry struct {
+	Path    string       `json:"path"`
+	ModTime int64        `json:"mtime"`
+	Size    int64        `json:"size"`
+	Hash    string       `json:"hash"`
+	Note    *models.Note `json:"note"`
+}
+
+type cacheFile struct {
+	Version int               `json:"version"`
+	Key     string            `json:"key"`
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// Index keeps the parsed notes of a vault in memory and on disk. Files are
+// only re-parsed when their mtime, size and content hash indicate a change.
+type Index struct {
+	// Workers is the number of files parsed concurrently by Refresh
+	Workers int
+
+	mu        sync.RWMutex
+	cachePath string
+	key       string
+	parse     ParseFunc
+	entries   map[string]*Entry
+	dirty     bool
+	// query indexes the tags and assignees of the todos. It is built on
+	// demand and dropped whenever the indexed notes change.
+	query *tagquery.Index
+}
+
+// New creates an empty index persisted to cachePath. key identifies the
+// parser configuration; a cache written with a different key is discarded on
+// Load.
+func New(cachePath string, key string, parse ParseFunc) *Index {
+	return &Index{
+		Workers:   runtime.NumCPU(),
+		cachePath: cachePath,
+		key:       key,
+		parse:     parse,
+		entries:   map[string]*Entry{},
+	}
+}
+
+// DefaultCachePath returns the location of the cache file for the vault in
+// root inside the users cache directory
+func DefaultCachePath(root string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(cacheDir, "granite.nvim", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// Load reads the cache file. A missing cache, one written by another version
+// or key or one with entries lacking their note is not an error, the index
+// just starts out empty.
+func (i *Index) Load() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	raw, err := os.ReadFile(i.cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading index cache: %w", err)
+	}
+
+	cache := &cacheFile{}
+	err = json.Unmarshal(raw, cache)
+	if err != nil {
+		return fmt.Errorf("Error parsing index cache: %w", err)
+	}
+
+	if cache.Version != VERSION || cache.Key != i.key || cache.Entries == nil {
+		return nil
+	}
+
+	for _, entry := range cache.Entries {
+		if entry == nil || entry.Note == nil {
+			return nil
+		}
+	}
+	for _, entry := range cache.Entries {
+		models.LinkTodos(entry.Note.Todos)
+	}
+	i.entries = cache.Entries
+	i.dirty = false
+	i.query = nil
+	return nil
+}
+
+// Save writes the index to the cache file if it changed since the last Load
+// or Save
+func (i *Index) Save() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.dirty {
+		return nil
+	}
+
+	raw, err := json.Marshal(&cacheFile{
+		Version: VERSION,
+		Key:     i.key,
+		Entries: i.entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(i.cachePath), 0755)
+	if err != nil {
+		return fmt.Errorf("Error creating index cache folder: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(i.cachePath), ".index-*.json")
+	if err != nil {
+		return fmt.Errorf("Error creating index cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(raw)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing index cache: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), i.cachePath)
+	if err != nil {
+		return fmt.Errorf("Error writing index cache: %w", err)
+	}
+	i.dirty = false
+	return nil
+}
+
+// Refresh brings the index in line with the given list of files. Files that
+// are not part of paths are dropped, new and modified files are parsed on a
+// pool of Workers goroutines. When ctx is cancelled Refresh stops early and
+// returns the context error; files parsed up to that point are kept.
+func (i *Index) Refresh(ctx context.Context, paths []string) error {
+	workers := i.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan string)
+	results := make(chan *loadResult)
+	wg := sync.WaitGroup{}
+
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				results <- i.load(p)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, p := range paths {
+			select {
+			case jobs <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	errs := map[string]error{}
+	for res := range results {
+		i.mu.Lock()
+		_, err := i.apply(res)
+		i.mu.Unlock()
+		if err != nil {
+			errs[res.path] = err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	seen := map[string]bool{}
+	for _, p := range paths {
+		seen[p] = true
+	}
+
+	i.mu.Lock()
+	for p := range i.entries {
+		if !seen[p] {
+			delete(i.entries, p)
+			i.dirty = true
+			i.query = nil
+		}
+	}
+	i.mu.Unlock()
+
+	// report errors in a stable order, independent of scheduling
+	errPaths := make([]string, 0, len(errs))
+	for p := range errs {
+		errPaths = append(errPaths, p)
+	}
+	sort.Strings(errPaths)
+	joined := make([]error, 0, len(errPaths))
+	for _, p := range errPaths {
+		joined = append(joined, errs[p])
+	}
+	return errors.Join(joined...)
+}
+
+// Update re-checks a single file and re-parses it when it changed. A file
+// that no longer exists is removed from the index. The returned bool reports
+// whether the todos of the file changed.
+func (i *Index) Update(path string) (bool, error) {
+	res := i.load(path)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.apply(res)
+}
+
+// Remove drops path and everything below it from the index. It returns the
+// paths of all removed files.
+func (i *Index) Remove(path string) []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	removed := []string{}
+	prefix := path + string(filepath.Separator)
+	for p := range i.entries {
+		if p == path || strings.HasPrefix(p, prefix) {
+			delete(i.entries, p)
+			removed = append(removed, p)
+		}
+	}
+	if len(removed) > 0 {
+		i.dirty = true
+		i.query = nil
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// loadResult is the outcome of checking a single file against the index
+type loadResult struct {
+	path    string
+	missing bool
+	// entry is nil when the cached entry is still valid
+	entry *Entry
+	// touched is set when only mtime and size changed but not the content
+	touched bool
+	err     error
+}
+
+// load does the expensive part of an update, stat-ing, reading and parsing
+// the file, without holding the write lock
+func (i *Index) load(path string) *loadResult {
+	res := &loadResult{path: path}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		res.missing = true
+		return res
+	}
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	i.mu.RLock()
+	cached, ok := i.entries[path]
+	i.mu.RUnlock()
+
+	if ok && cached.ModTime == info.ModTime().UnixNano() && cached.Size == info.Size() {
+		return res
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	entry := &Entry{
+		Path:    path,
+		ModTime: info.ModTime().UnixNano(),
+		Size:    info.Size(),
+		Hash:    hashContent(content),
+	}
+	res.entry = entry
+
+	if ok && cached.Hash == entry.Hash {
+		res.touched = true
+		return res
+	}
+
+	entry.Note, err = i.parse(path, content)
+	if err != nil {
+		res.err = fmt.Errorf("Error parsing %s: %w", path, err)
+	}
+	return res
+}
+
+// apply stores the result of load in the index. The caller must hold the
+// write lock.
+func (i *Index) apply(res *loadResult) (bool, error) {
+	if res.err != nil {
+		return false, res.err
+	}
+
+	cached, ok := i.entries[res.path]
+
+	if res.missing {
+		if !ok {
+			return false, nil
+		}
+		delete(i.entries, res.path)
+		i.dirty = true
+		i.query = nil
+		return len(cached.Note.Todos) > 0, nil
+	}
+
+	if res.entry == nil {
+		return false, nil
+	}
+
+	if res.touched {
+		if ok {
+			cached.ModTime = res.entry.ModTime
+			cached.Size = res.entry.Size
+			i.dirty = true
+		}
+		return false, nil
+	}
+
+	changed := len(res.entry.Note.Todos) > 0
+	if ok {
+		changed = !reflect.DeepEqual(cached.Note.Todos, res.entry.Note.Todos)
+	}
+
+	i.entries[res.path] = res.entry
+	i.dirty = true
+	i.query = nil
+	return changed, nil
+}
+
+// Notes returns all indexed notes ordered by path
+func (i *Index) Notes() []*models.Note {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.notes()
+}
+
+// notes returns all indexed notes ordered by path. The caller must hold the
+// lock.
+func (i *Index) notes() []*models.Note {
+	paths := make([]string, 0, len(i.entries))
+	for p := range i.entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	notes := make([]*models.Note, 0, len(paths))
+	for _, p := range paths {
+		notes = append(notes, i.entries[p].Note)
+	}
+	return notes
+}
+
+// Todos returns the todos of all indexed notes, ordered by path and position
+// in the file
+func (i *Index) Todos() []*models.Todo {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.todos()
+}
+
+// todos returns the todos of all indexed notes. The caller must hold the
+// lock.
+func (i *Index) todos() []*models.Todo {
+	todos := []*models.Todo{}
+	for _, note := range i.notes() {
+		todos = append(todos, note.Todos...)
+	}
+	return todos
+}
+
+// QueryIndex returns the tagquery index of Todos. It is built once for
+// every state of the indexed notes and shared until they change.
+func (i *Index) QueryIndex() *tagquery.Index {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.query == nil {
+		i.query = tagquery.NewIndex(i.todos())
+	}
+	return i.query
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
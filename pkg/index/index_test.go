@@ -0,0 +1,190 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+)
+
+func TestIndexRefresh(t *testing.T) {
+	dir := t.TempDir()
+	notePath := filepath.Join(dir, "note.md")
+	cachePath := filepath.Join(dir, "cache", "index.json")
+
+	err := os.WriteFile(notePath, []byte("- [ ] #task one\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := 0
+	parse := func(path string, content []byte) (*models.Note, error) {
+		parsed++
+		return &models.Note{
+			Path:  path,
+			Todos: []*models.Todo{{Text: string(content), FilePath: path}},
+		}, nil
+	}
+
+	idx := New(cachePath, "key", parse)
+	if err := idx.Refresh(context.Background(), []string{notePath}); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if err := idx.Refresh(context.Background(), []string{notePath}); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if parsed != 1 {
+		t.Errorf("expected unchanged file to be parsed once, got %d", parsed)
+	}
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reloaded := New(cachePath, "key", parse)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := reloaded.Refresh(context.Background(), []string{notePath}); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if parsed != 1 {
+		t.Errorf("expected cached file not to be parsed after reload, got %d parses", parsed)
+	}
+	if got := len(reloaded.Todos()); got != 1 {
+		t.Errorf("expected 1 todo after reload, got %d", got)
+	}
+
+	later := time.Now().Add(time.Minute)
+	err = os.WriteFile(notePath, []byte("- [x] #task one\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(notePath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Refresh(context.Background(), []string{notePath}); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if parsed != 2 {
+		t.Errorf("expected modified file to be parsed again, got %d parses", parsed)
+	}
+
+	otherKey := New(cachePath, "other", parse)
+	if err := otherKey.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := len(otherKey.Todos()); got != 0 {
+		t.Errorf("expected cache with different key to be discarded, got %d todos", got)
+	}
+
+	if err := reloaded.Refresh(context.Background(), []string{}); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got := len(reloaded.Todos()); got != 0 {
+		t.Errorf("expected removed file to be dropped, got %d todos", got)
+	}
+}
+
+func TestIndexLoadCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "index.json")
+	raw, err := json.Marshal(&cacheFile{
+		Version: VERSION,
+		Key:     "key",
+		Entries: map[string]*Entry{
+			"a.md": {Path: "a.md", Note: &models.Note{Path: "a.md", Todos: []*models.Todo{{Text: "one"}}}},
+			"b.md": {Path: "b.md"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := New(cachePath, "key", nil)
+	if err := idx.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := len(idx.Notes()); got != 0 {
+		t.Errorf("expected cache with an entry without note to be discarded, got %d notes", got)
+	}
+}
+
+func TestIndexRefreshCancelled(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{}
+	for _, name := range []string{"a.md", "b.md", "c.md"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+
+	idx := New(filepath.Join(dir, "index.json"), "key", func(path string, content []byte) (*models.Note, error) {
+		return &models.Note{Path: path}, nil
+	})
+	idx.Workers = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := idx.Refresh(ctx, paths); err != context.Canceled {
+		t.Errorf("Refresh() error = %v, want %v", err, context.Canceled)
+	}
+
+	if err := idx.Refresh(context.Background(), paths); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	notes := idx.Notes()
+	if len(notes) != len(paths) {
+		t.Fatalf("expected %d notes, got %d", len(paths), len(notes))
+	}
+	for n, note := range notes {
+		if note.Path != paths[n] {
+			t.Errorf("notes not ordered by path: got %s at %d, want %s", note.Path, n, paths[n])
+		}
+	}
+}
+
+func TestIndexQueryIndex(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")}
+	for _, p := range paths {
+		if err := os.WriteFile(p, []byte("- [ ] #task one\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parse := func(path string, content []byte) (*models.Note, error) {
+		return &models.Note{
+			Path:  path,
+			Todos: []*models.Todo{{Text: string(content), FilePath: path}},
+		}, nil
+	}
+
+	idx := New(filepath.Join(dir, "index.json"), "key", parse)
+	if err := idx.Refresh(context.Background(), paths); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	query := idx.QueryIndex()
+	if !query.Indexes(idx.Todos()) {
+		t.Errorf("QueryIndex() doesn't index Todos()")
+	}
+	if err := idx.Refresh(context.Background(), paths); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if idx.QueryIndex() != query {
+		t.Errorf("QueryIndex() was built again without a change")
+	}
+
+	idx.Remove(paths[1])
+	changed := idx.QueryIndex()
+	if changed == query || !changed.Indexes(idx.Todos()) {
+		t.Errorf("QueryIndex() wasn't built again after a note was removed")
+	}
+}
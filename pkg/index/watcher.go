@@ -0,0 +1,181 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long the watcher waits for further events before it
+// re-parses the affected files
+const DefaultDebounce = 200 * time.Millisecond
+
+// Rules decide which files and directories the watcher looks at
+type Rules interface {
+	// IsNote decides which files get indexed
+	IsNote(path string) bool
+	// SkipDir decides which directories are not watched
+	SkipDir(path string) bool
+}
+
+// Watcher keeps an Index in sync with the files below Root. It uses the
+// native file notification mechanism of the platform, inotify on linux.
+type Watcher struct {
+	Index *Index
+	Root  string
+	Rules Rules
+	// Debounce is the quiet period after the last event before changes are
+	// processed
+	Debounce time.Duration
+	// OnChange is called with the paths of all files whose todos changed
+	OnChange func(paths []string)
+	// OnError is called for errors that don't stop the watcher
+	OnError func(err error)
+
+	fsw *fsnotify.Watcher
+}
+
+// NewWatcher creates a watcher for root that updates idx. Call Run to start
+// watching.
+func NewWatcher(idx *Index, root string, rules Rules) *Watcher {
+	return &Watcher{
+		Index:    idx,
+		Root:     root,
+		Rules:    rules,
+		Debounce: DefaultDebounce,
+		OnChange: func([]string) {},
+		OnError:  func(error) {},
+	}
+}
+
+// Run watches Root until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+	w.fsw = fsw
+
+	_, err = w.addRecursive(w.Root)
+	if err != nil {
+		return err
+	}
+
+	pending := map[string]bool{}
+	timer := time.NewTimer(w.Debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			pending[event.Name] = true
+			timer.Reset(w.Debounce)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			w.OnError(err)
+		case <-timer.C:
+			w.process(pending)
+			pending = map[string]bool{}
+		}
+	}
+}
+
+func (w *Watcher) process(pending map[string]bool) {
+	changed := map[string]bool{}
+
+	for path := range pending {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			for _, removed := range w.Index.Remove(path) {
+				changed[removed] = true
+			}
+			continue
+		}
+		if err != nil {
+			w.OnError(err)
+			continue
+		}
+
+		if info.IsDir() {
+			if w.Rules.SkipDir(path) {
+				continue
+			}
+			// files created together with the directory don't produce
+			// events of their own
+			notes, err := w.addRecursive(path)
+			if err != nil {
+				w.OnError(err)
+			}
+			for _, note := range notes {
+				w.update(note, changed)
+			}
+			continue
+		}
+
+		if w.Rules.IsNote(path) {
+			w.update(path, changed)
+		}
+	}
+
+	err := w.Index.Save()
+	if err != nil {
+		w.OnError(err)
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(changed))
+	for p := range changed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	w.OnChange(paths)
+}
+
+func (w *Watcher) update(path string, changed map[string]bool) {
+	todosChanged, err := w.Index.Update(path)
+	if err != nil {
+		w.OnError(err)
+	}
+	if todosChanged {
+		changed[path] = true
+	}
+}
+
+// addRecursive adds a watch for dir and all directories below it and returns
+// the notes it found on the way
+func (w *Watcher) addRecursive(dir string) ([]string, error) {
+	notes := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			if w.Rules.IsNote(path) {
+				notes = append(notes, path)
+			}
+			return nil
+		}
+		if w.Rules.SkipDir(path) {
+			return filepath.SkipDir
+		}
+		return w.fsw.Add(path)
+	})
+	return notes, err
+}
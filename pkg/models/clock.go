@@ -0,0 +1,111 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CLOCK_TIME_FORMAT is the org mode timestamp format of clock entries
+const CLOCK_TIME_FORMAT = "2006-01-02 Mon 15:04"
+
+// CLOCK_PREFIX starts a clock entry
+const CLOCK_PREFIX = "CLOCK:"
+
+// clockRegex matches org mode clock entries like
+// CLOCK: [2024-05-01 Wed 09:00]--[2024-05-01 Wed 10:30] =>  1:30
+// and running ones like CLOCK: [2024-05-01 Wed 09:00]
+var clockRegex = regexp.MustCompile(`^\s*CLOCK:\s*\[([^\]]+)\](?:--\[([^\]]+)\])?(?:\s*=>\s*\S+)?\s*$`)
+
+// Clock is a time tracking entry of a todo
+type Clock struct {
+	// Start is when the clock started, formatted as CLOCK_TIME_FORMAT
+	Start string `json:"start"`
+	// End is when the clock stopped, empty while it is running
+	End string `json:"end,omitempty"`
+	// Seconds is the tracked time of stopped clocks
+	Seconds int64 `json:"seconds"`
+	// LineNumber is the line of the entry in the file
+	LineNumber int `json:"lnum"`
+}
+
+// ParseClock parses a clock entry. ok is false for lines that aren't one.
+func ParseClock(line string) (clock *Clock, ok bool) {
+	m := clockRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	start, err := time.ParseInLocation(CLOCK_TIME_FORMAT, m[1], time.Local)
+	if err != nil {
+		return nil, false
+	}
+	clock = &Clock{Start: m[1]}
+	if m[2] != "" {
+		end, err := time.ParseInLocation(CLOCK_TIME_FORMAT, m[2], time.Local)
+		if err != nil || end.Before(start) {
+			return nil, false
+		}
+		clock.End = m[2]
+		clock.Seconds = int64(end.Sub(start) / time.Second)
+	}
+	return clock, true
+}
+
+// FormatClock formats a clock entry started at start. With a zero end the
+// entry is running.
+func FormatClock(start time.Time, end time.Time) string {
+	entry := fmt.Sprintf("%s [%s]", CLOCK_PREFIX, start.Format(CLOCK_TIME_FORMAT))
+	if end.IsZero() {
+		return entry
+	}
+	minutes := int(end.Truncate(time.Minute).Sub(start.Truncate(time.Minute)) / time.Minute)
+	return fmt.Sprintf("%s--[%s] => %2d:%02d", entry, end.Format(CLOCK_TIME_FORMAT), minutes/60, minutes%60)
+}
+
+// StartTime returns the start of the clock
+func (c *Clock) StartTime() time.Time {
+	t, _ := time.ParseInLocation(CLOCK_TIME_FORMAT, c.Start, time.Local)
+	return t
+}
+
+// Running reports whether the clock wasn't stopped yet
+func (c *Clock) Running() bool {
+	return c.End == ""
+}
+
+// SecondsAt returns the tracked time of the clock, running clocks count
+// until the minute of now, like they would when stopped at now
+func (c *Clock) SecondsAt(now time.Time) int64 {
+	if !c.Running() {
+		return c.Seconds
+	}
+	if seconds := int64(now.Truncate(time.Minute).Sub(c.StartTime()) / time.Second); seconds > 0 {
+		return seconds
+	}
+	return 0
+}
+
+// RunningClock returns the running clock of the todo
+func (t *Todo) RunningClock() (*Clock, bool) {
+	for _, clock := range t.Clocks {
+		if clock.Running() {
+			return clock, true
+		}
+	}
+	return nil, false
+}
+
+// SetClocks sets the clock entries of the todo and sums up their time
+func (t *Todo) SetClocks(clocks []*Clock) {
+	t.Clocks = clocks
+	t.TrackedSeconds = 0
+	for _, clock := range clocks {
+		t.TrackedSeconds += clock.Seconds
+	}
+}
+
+// IsClockLine reports whether line is a clock entry
+func IsClockLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), CLOCK_PREFIX)
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockRoundTrip(t *testing.T) {
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.Local)
+	end := time.Date(2024, 5, 1, 10, 30, 45, 0, time.Local)
+
+	line := FormatClock(start, end)
+	if line != "CLOCK: [2024-05-01 Wed 09:00]--[2024-05-01 Wed 10:30] =>  1:30" {
+		t.Errorf("FormatClock() = %q", line)
+	}
+	clock, ok := ParseClock("    " + line)
+	if !ok || clock.Seconds != 5400 || clock.Running() {
+		t.Errorf("ParseClock(%q) = %+v, %v", line, clock, ok)
+	}
+
+	running, ok := ParseClock(FormatClock(start, time.Time{}))
+	if !ok || !running.Running() {
+		t.Fatalf("running clock parsed as %+v, %v", running, ok)
+	}
+	if seconds := running.SecondsAt(end); seconds != 5400 {
+		t.Errorf("running clock tracked %d seconds", seconds)
+	}
+
+	for _, line := range []string{"CLOCK: nonsense", "clock: [2024-05-01 Wed 09:00]", "CLOCK: [2024-05-01 Wed 10:00]--[2024-05-01 Wed 09:00]"} {
+		if _, ok := ParseClock(line); ok {
+			t.Errorf("ParseClock(%q) accepted an invalid entry", line)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DEPENDENCY_FIELDS reference the todos a todo depends on, eg: after:foo,bar
+var DEPENDENCY_FIELDS = []string{"after", "blocked-by"}
+
+// DependencyGraph holds the resolved dependencies between todos
+type DependencyGraph struct {
+	// Todos are all todos that depend on another todo or are depended on, in
+	// the order they were passed to ResolveDependencies
+	Todos []*Todo
+	// Dependencies maps todos to the todos they depend on
+	Dependencies map[*Todo][]*Todo
+	// Errors describes unknown references, duplicate ids and cycles
+	Errors []string
+}
+
+// parseDependencies reads the id: field and the references of the
+// DEPENDENCY_FIELDS
+func (t *Todo) parseDependencies() {
+	t.TaskID = ""
+	if id, ok := t.Fields["id"]; ok {
+		t.TaskID = id.Raw
+	}
+	t.DependsOn = nil
+	for _, key := range DEPENDENCY_FIELDS {
+		field, ok := t.Fields[key]
+		if !ok {
+			continue
+		}
+		for _, ref := range strings.Split(field.Raw, ",") {
+			ref = strings.TrimSpace(ref)
+			if ref != "" && !slices.Contains(t.DependsOn, ref) {
+				t.DependsOn = append(t.DependsOn, ref)
+			}
+		}
+	}
+}
+
+// ResolveDependencies resolves the references of all todos to the todos
+// they depend on. References are matched against id: fields first and the
+// IDs of todos, like their block anchors, second. It sets Blocked, BlockedBy,
+// Actionable and DependencyErrors on every todo. A todo is blocked while one
+// of its dependencies is open or when it is part of a cycle. Unknown
+// references are reported, but don't block.
+func ResolveDependencies(todos []*Todo) *DependencyGraph {
+	graph := &DependencyGraph{Dependencies: map[*Todo][]*Todo{}}
+
+	byTaskID := map[string]*Todo{}
+	byID := map[string]*Todo{}
+	for _, todo := range todos {
+		todo.Blocked = false
+		todo.BlockedBy = nil
+		todo.DependencyErrors = nil
+		if todo.TaskID != "" {
+			if other, ok := byTaskID[todo.TaskID]; ok {
+				todo.addDependencyError(graph, "Duplicate id %s, already used in %s:%d", todo.TaskID, other.FilePath, other.LineNumber)
+			} else {
+				byTaskID[todo.TaskID] = todo
+			}
+		}
+		byID[todo.ID] = todo
+	}
+
+	linked := map[*Todo]bool{}
+	for _, todo := range todos {
+		for _, ref := range todo.DependsOn {
+			dep, ok := byTaskID[ref]
+			if !ok {
+				dep, ok = byID[ref]
+			}
+			if !ok {
+				todo.addDependencyError(graph, "Unknown dependency %s", ref)
+				continue
+			}
+			graph.Dependencies[todo] = append(graph.Dependencies[todo], dep)
+			linked[todo] = true
+			linked[dep] = true
+			if !dep.Closed {
+				todo.Blocked = true
+				todo.BlockedBy = append(todo.BlockedBy, ref)
+			}
+		}
+	}
+
+	for _, cycle := range graph.cycles(todos) {
+		names := []string{}
+		for _, todo := range cycle {
+			names = append(names, todo.DependencyName())
+		}
+		description := strings.Join(append(names, names[0]), " -> ")
+		for _, todo := range cycle {
+			todo.Blocked = true
+			todo.addDependencyError(graph, "Dependency cycle %s", description)
+		}
+	}
+
+	for _, todo := range todos {
+		todo.Actionable = !todo.Closed && !todo.Blocked
+		if linked[todo] {
+			graph.Todos = append(graph.Todos, todo)
+		}
+	}
+	return graph
+}
+
+// DependencyName is the name of the todo in dependency errors and graphs,
+// its id: field if it has one, its ID otherwise
+func (t *Todo) DependencyName() string {
+	if t.TaskID != "" {
+		return t.TaskID
+	}
+	return t.ID
+}
+
+func (t *Todo) addDependencyError(graph *DependencyGraph, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	t.DependencyErrors = append(t.DependencyErrors, msg)
+	graph.Errors = append(graph.Errors, fmt.Sprintf("%s:%d: %s", t.FilePath, t.LineNumber, msg))
+}
+
+// cycles returns every cycle of the graph once, found by a depth first search
+func (g *DependencyGraph) cycles(todos []*Todo) [][]*Todo {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[*Todo]int{}
+	stack := []*Todo{}
+	cycles := [][]*Todo{}
+
+	var visit func(todo *Todo)
+	visit = func(todo *Todo) {
+		state[todo] = visiting
+		stack = append(stack, todo)
+		for _, dep := range g.Dependencies[todo] {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dep {
+						cycles = append(cycles, append([]*Todo{}, stack[i:]...))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[todo] = visited
+	}
+
+	for _, todo := range todos {
+		if state[todo] == unvisited {
+			visit(todo)
+		}
+	}
+	return cycles
+}
+
+// DOT renders the graph in the graphviz dot language. Edges point from a
+// todo to the todos that wait for it. Closed todos are grey, blocked ones red
+// and actionable ones green.
+func (g *DependencyGraph) DOT() string {
+	b := strings.Builder{}
+	b.WriteString("digraph dependencies {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, style=rounded];\n")
+	for _, msg := range g.Errors {
+		fmt.Fprintf(&b, "\t// %s\n", strings.ReplaceAll(msg, "\n", " "))
+	}
+	for _, todo := range g.Todos {
+		color := "darkgreen"
+		if todo.Closed {
+			color = "grey"
+		} else if todo.Blocked {
+			color = "red"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s, color=%s, tooltip=%s];\n",
+			dotQuote(todo.ID), dotQuote(todo.dotLabel()), color, dotQuote(fmt.Sprintf("%s:%d", todo.FilePath, todo.LineNumber)))
+	}
+
+	edges := []string{}
+	for todo, deps := range g.Dependencies {
+		for _, dep := range deps {
+			edges = append(edges, fmt.Sprintf("\t%s -> %s;\n", dotQuote(dep.ID), dotQuote(todo.ID)))
+		}
+	}
+	sort.Strings(edges)
+	for _, edge := range edges {
+		b.WriteString(edge)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (t *Todo) dotLabel() string {
+	text := t.Text
+	if loc := stateRegex.FindStringIndex(text); loc != nil && loc[0] == 0 {
+		text = strings.TrimSpace(text[loc[1]:])
+	}
+	if t.TaskID != "" {
+		return t.TaskID + ": " + text
+	}
+	return text
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
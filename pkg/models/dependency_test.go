@@ -0,0 +1,86 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	design := parseTodo(t, "- [x] #task design id:design")
+	build := parseTodo(t, "- [ ] #task build id:build after:design")
+	test := parseTodo(t, "- [ ] #task test id:test after:build,design")
+	ship := parseTodo(t, "- [ ] #task ship blocked-by:test,missing")
+
+	graph := ResolveDependencies([]*Todo{design, build, test, ship})
+
+	tests := []struct {
+		todo       *Todo
+		blocked    bool
+		actionable bool
+		blockedBy  []string
+	}{
+		{design, false, false, nil},
+		{build, false, true, nil},
+		{test, true, false, []string{"build"}},
+		{ship, true, false, []string{"test"}},
+	}
+	for _, tt := range tests {
+		if tt.todo.Blocked != tt.blocked || tt.todo.Actionable != tt.actionable {
+			t.Errorf("%s: Blocked, Actionable = %v, %v, want %v, %v", tt.todo.Text, tt.todo.Blocked, tt.todo.Actionable, tt.blocked, tt.actionable)
+		}
+		if !reflect.DeepEqual(tt.todo.BlockedBy, tt.blockedBy) {
+			t.Errorf("%s: BlockedBy = %v, want %v", tt.todo.Text, tt.todo.BlockedBy, tt.blockedBy)
+		}
+	}
+
+	if want := []string{"Unknown dependency missing"}; !reflect.DeepEqual(ship.DependencyErrors, want) {
+		t.Errorf("DependencyErrors = %v, want %v", ship.DependencyErrors, want)
+	}
+	if len(graph.Todos) != 4 || len(graph.Errors) != 1 {
+		t.Errorf("graph has %d todos and errors %v, want 4 todos and 1 error", len(graph.Todos), graph.Errors)
+	}
+}
+
+func TestResolveDependencyCycles(t *testing.T) {
+	a := parseTodo(t, "- [ ] #task a id:a after:c")
+	b := parseTodo(t, "- [ ] #task b id:b after:a")
+	c := parseTodo(t, "- [x] #task c id:c after:b")
+	other := parseTodo(t, "- [ ] #task other id:a")
+
+	graph := ResolveDependencies([]*Todo{a, b, c, other})
+
+	for _, todo := range []*Todo{a, b, c} {
+		if !todo.Blocked || todo.Actionable {
+			t.Errorf("%s: Blocked, Actionable = %v, %v, want true, false", todo.Text, todo.Blocked, todo.Actionable)
+		}
+		if len(todo.DependencyErrors) != 1 || !strings.HasPrefix(todo.DependencyErrors[0], "Dependency cycle") {
+			t.Errorf("%s: DependencyErrors = %v, want a cycle", todo.Text, todo.DependencyErrors)
+		}
+	}
+	if len(other.DependencyErrors) != 1 || !strings.HasPrefix(other.DependencyErrors[0], "Duplicate id a") {
+		t.Errorf("DependencyErrors = %v, want a duplicate id", other.DependencyErrors)
+	}
+	if len(graph.Errors) != 4 {
+		t.Errorf("Errors = %v, want 4 errors", graph.Errors)
+	}
+}
+
+func TestDependencyDOT(t *testing.T) {
+	design := parseTodo(t, "- [x] #task design id:design")
+	build := parseTodo(t, `- [ ] #task build "it" id:build after:design`)
+	design.ID, build.ID = "t1", "t2"
+
+	dot := ResolveDependencies([]*Todo{design, build}).DOT()
+
+	for _, want := range []string{
+		"digraph dependencies {\n",
+		`label="design: #task design id:design", color=grey`,
+		`label="build: #task build \"it\" id:build after:design", color=darkgreen`,
+		"\t\"t1\" -> \"t2\";\n",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT() = %s, want it to contain %s", dot, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// HOURS_PER_DAY and DAYS_PER_WEEK convert estimates to working time, so
+// ~2d is 16 hours of work and ~1w 40 hours
+const (
+	HOURS_PER_DAY = 8
+	DAYS_PER_WEEK = 5
+)
+
+// ESTIMATE_FIELD holds the effort estimate of a todo, eg: estimate:3h
+const ESTIMATE_FIELD = "estimate"
+
+// estimateRegex matches the ~2d shorthand for estimate fields
+var estimateRegex = regexp.MustCompile(`(?:^|\s)~((?:\d+(?:\.\d+)?[wdhm])+)(?:\s|$)`)
+
+var estimateUnits = map[string]time.Duration{
+	"w": DAYS_PER_WEEK * HOURS_PER_DAY * time.Hour,
+	"d": HOURS_PER_DAY * time.Hour,
+	"h": time.Hour,
+	"m": time.Minute,
+	"s": time.Second,
+}
+
+// Effort sums up estimated work
+type Effort struct {
+	// RemainingSeconds is the estimated work of open todos
+	RemainingSeconds int64 `json:"remaining_seconds"`
+	// CompletedSeconds is the estimated work of closed todos
+	CompletedSeconds int64 `json:"completed_seconds"`
+}
+
+// Add adds the effort of other to e
+func (e *Effort) Add(other Effort) {
+	e.RemainingSeconds += other.RemainingSeconds
+	e.CompletedSeconds += other.CompletedSeconds
+}
+
+// ParseEstimate parses estimates like 3h, 1h30m or 2d in working time, see
+// HOURS_PER_DAY and DAYS_PER_WEEK
+func ParseEstimate(raw string) (time.Duration, bool) {
+	if !durationRegex.MatchString(raw) {
+		return 0, false
+	}
+	var total time.Duration
+	for _, part := range durationPartRegex.FindAllStringSubmatch(raw, -1) {
+		n, err := strconv.ParseFloat(part[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		total += time.Duration(n * float64(estimateUnits[part[2]]))
+	}
+	return total, true
+}
+
+// parseEstimate reads the estimate: field, or the ~ shorthand without one
+func (t *Todo) parseEstimate() {
+	t.EstimateSeconds = 0
+	raw := ""
+	if field, ok := t.Fields[ESTIMATE_FIELD]; ok {
+		raw = field.Raw
+	} else if m := estimateRegex.FindStringSubmatch(t.RawLine); m != nil {
+		raw = m[1]
+	}
+	if d, ok := ParseEstimate(raw); ok {
+		t.EstimateSeconds = int64(d / time.Second)
+	}
+}
+
+// RollUpEstimates sums up the estimates of todos through their subtasks and
+// sets the Effort of every todo. Estimated subtasks break down the work of
+// their parent: the Effort of a todo is the Effort of its subtasks plus the
+// part of its own estimate they don't cover. The estimates of closed todos
+// and everything nested in them count as completed.
+func RollUpEstimates(todos []*Todo) {
+	for _, todo := range todos {
+		if todo.Parent == nil {
+			todo.rollUpEstimate(false)
+		}
+	}
+}
+
+func (t *Todo) rollUpEstimate(closedParent bool) {
+	closed := closedParent || t.Closed
+	t.Effort = Effort{}
+	for _, child := range t.Children {
+		child.rollUpEstimate(closed)
+		t.Effort.Add(child.Effort)
+	}
+	unallocated := t.EstimateSeconds - t.Effort.RemainingSeconds - t.Effort.CompletedSeconds
+	if unallocated <= 0 {
+		return
+	}
+	if closed {
+		t.Effort.CompletedSeconds += unallocated
+	} else {
+		t.Effort.RemainingSeconds += unallocated
+	}
+}
+
+// OwnEffort is the part of the Effort of the todo that isn't rolled up from
+// its subtasks. Summing it up over any set of todos counts each estimate
+// once.
+func (t *Todo) OwnEffort() Effort {
+	own := t.Effort
+	for _, child := range t.Children {
+		own.RemainingSeconds -= child.Effort.RemainingSeconds
+		own.CompletedSeconds -= child.Effort.CompletedSeconds
+	}
+	return own
+}
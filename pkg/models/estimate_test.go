@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEstimate(t *testing.T) {
+	tests := map[string]time.Duration{
+		"3h":    3 * time.Hour,
+		"1h30m": 90 * time.Minute,
+		"2d":    16 * time.Hour,
+		"1.5d":  12 * time.Hour,
+		"1w":    40 * time.Hour,
+	}
+	for raw, want := range tests {
+		if got, ok := ParseEstimate(raw); !ok || got != want {
+			t.Errorf("ParseEstimate(%q) = %v, %v, want %v", raw, got, ok, want)
+		}
+	}
+	if _, ok := ParseEstimate("soon"); ok {
+		t.Errorf("ParseEstimate(%q) is ok", "soon")
+	}
+}
+
+func TestTodoEstimate(t *testing.T) {
+	tests := map[string]int64{
+		"- [ ] #task plan the sprint estimate:3h": 3 * 3600,
+		"- [ ] #task plan the sprint ~2d":         16 * 3600,
+		"- [ ] #task plan [estimate:: 1h] ~2d":    3600,
+		"- [ ] #task plan the sprint ~~2d":        0,
+		"- [ ] #task plan the sprint":             0,
+	}
+	for line, want := range tests {
+		if got := parseTodo(t, line).EstimateSeconds; got != want {
+			t.Errorf("%q: EstimateSeconds = %d, want %d", line, got, want)
+		}
+	}
+
+	todo := parseTodo(t, "- [ ] #task plan the sprint estimate:2d")
+	if field := todo.Fields[ESTIMATE_FIELD]; field.Seconds != todo.EstimateSeconds {
+		t.Errorf("estimate field has %d seconds, EstimateSeconds = %d", field.Seconds, todo.EstimateSeconds)
+	}
+}
+
+func TestRollUpEstimates(t *testing.T) {
+	epic := parseTodo(t, "- [ ] #task epic ~1w")
+	done := parseTodo(t, "- [x] #task done ~3h")
+	open := parseTodo(t, "- [ ] #task open ~1d")
+	unestimated := parseTodo(t, "- [ ] #task unestimated")
+	closed := parseTodo(t, "- [x] #task closed ~1d")
+	forgotten := parseTodo(t, "- [ ] #task forgotten ~2h")
+	epic.AddChild(done)
+	epic.AddChild(open)
+	epic.AddChild(unestimated)
+	closed.AddChild(forgotten)
+	overbooked := parseTodo(t, "- [ ] #task overbooked ~2h")
+	subtask := parseTodo(t, "- [ ] #task subtask ~3h")
+	overbooked.AddChild(subtask)
+
+	RollUpEstimates([]*Todo{epic, done, open, unestimated, closed, forgotten, overbooked, subtask})
+
+	tests := []struct {
+		todo *Todo
+		want Effort
+		own  Effort
+	}{
+		{epic, Effort{37 * 3600, 3 * 3600}, Effort{29 * 3600, 0}},
+		{done, Effort{0, 3 * 3600}, Effort{0, 3 * 3600}},
+		{open, Effort{8 * 3600, 0}, Effort{8 * 3600, 0}},
+		{unestimated, Effort{}, Effort{}},
+		{closed, Effort{0, 8 * 3600}, Effort{0, 6 * 3600}},
+		{forgotten, Effort{0, 2 * 3600}, Effort{0, 2 * 3600}},
+		{overbooked, Effort{3 * 3600, 0}, Effort{}},
+	}
+	for _, tt := range tests {
+		if tt.todo.Effort != tt.want || tt.todo.OwnEffort() != tt.own {
+			t.Errorf("%s: Effort = %+v, OwnEffort() = %+v, want %+v, %+v", tt.todo.Text, tt.todo.Effort, tt.todo.OwnEffort(), tt.want, tt.own)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/dates"
+	"github.com/mrWinston/granite.nvim/pkg/recur"
+)
+
+// FieldType is the kind of value an inline field holds
+type FieldType string
+
+const (
+	FIELD_DATE     FieldType = "date"
+	FIELD_DURATION FieldType = "duration"
+	FIELD_NUMBER   FieldType = "number"
+	FIELD_STRING   FieldType = "string"
+)
+
+// DATE_FORMAT is the format of date fields
+const DATE_FORMAT = dates.FORMAT
+
+// DATE_FIELDS are the fields that can hold relative dates like tomorrow or +3d
+var DATE_FIELDS = []string{"due", "scheduled", "start"}
+
+// Field is an inline key value pair of a todo, like due:2024-05-01 or
+// [estimate:: 2h]
+type Field struct {
+	// Type is the kind of value the field holds
+	Type FieldType `json:"type"`
+	// Raw is the value as written in the note
+	Raw string `json:"raw"`
+	// Date is the value of date fields, formatted as YYYY-MM-DD. It is empty
+	// for relative dates that aren't resolved yet
+	Date string `json:"date,omitempty"`
+	// Relative is true for date fields holding an expression like tomorrow
+	Relative bool `json:"relative,omitempty"`
+	// Base is the date a relative date was resolved against
+	Base string `json:"base,omitempty"`
+	// Seconds is the value of duration fields
+	Seconds int64 `json:"seconds,omitempty"`
+	// Number is the value of number fields
+	Number float64 `json:"number,omitempty"`
+	// Col and EndCol are the byte offsets of the whole field in RawLine
+	Col    int `json:"col"`
+	EndCol int `json:"end_col"`
+	// ValueCol and ValueEndCol are the byte offsets of the value in RawLine
+	ValueCol    int `json:"value_col"`
+	ValueEndCol int `json:"value_end_col"`
+}
+
+// RECURRENCE_FIELDS hold recurrence rules. Their values may contain spaces,
+// eg: every:2 days or every:month on 1st
+var RECURRENCE_FIELDS = []string{"every", "rrule"}
+
+// maxRecurrenceWords limits how far a recurrence value is extended
+const maxRecurrenceWords = 8
+
+// fieldRegex matches key:value. The value can't start with / so urls like
+// https://example.com are not taken for fields
+var fieldRegex = regexp.MustCompile(`(?:^|\s)([A-Za-z][A-Za-z0-9_-]*):([^\s/\[\]][^\s\[\]]*)`)
+
+// bracketFieldRegex matches dataview style [key:: value] fields
+var bracketFieldRegex = regexp.MustCompile(`\[([A-Za-z][A-Za-z0-9_ -]*)::\s*([^\]]*?)\s*\]`)
+
+// wordRegex matches the next whitespace separated word
+var wordRegex = regexp.MustCompile(`^\s+[^\s\[\]]+`)
+
+var durationRegex = regexp.MustCompile(`^(?:\d+(?:\.\d+)?[wdhms])+$`)
+
+var durationPartRegex = regexp.MustCompile(`(\d+(?:\.\d+)?)([wdhms])`)
+
+var durationUnits = map[string]time.Duration{
+	"w": 7 * 24 * time.Hour,
+	"d": 24 * time.Hour,
+	"h": time.Hour,
+	"m": time.Minute,
+	"s": time.Second,
+}
+
+// ParseFields finds the inline fields in line. Keys are lower cased, when a
+// key appears more than once the first occurrence wins.
+func ParseFields(line string) map[string]*Field {
+	fields := map[string]*Field{}
+
+	for _, m := range bracketFieldRegex.FindAllStringSubmatchIndex(line, -1) {
+		key := strings.ToLower(strings.TrimSpace(line[m[2]:m[3]]))
+		if _, ok := fields[key]; ok {
+			continue
+		}
+		field := newKeyField(key, line[m[4]:m[5]])
+		field.Col, field.EndCol = m[0], m[1]
+		field.ValueCol, field.ValueEndCol = m[4], m[5]
+		fields[key] = field
+	}
+
+	for _, m := range fieldRegex.FindAllStringSubmatchIndex(line, -1) {
+		key := strings.ToLower(line[m[2]:m[3]])
+		if _, ok := fields[key]; ok {
+			continue
+		}
+		end := m[5]
+		if slices.Contains(RECURRENCE_FIELDS, key) {
+			end = recurrenceEnd(line, m[4], end)
+		}
+		field := newKeyField(key, line[m[4]:end])
+		field.Col, field.EndCol = m[2], end
+		field.ValueCol, field.ValueEndCol = m[4], end
+		fields[key] = field
+	}
+
+	return fields
+}
+
+// NewField detects the type of raw and returns a field holding its value
+func NewField(raw string) *Field {
+	field := &Field{Type: FIELD_STRING, Raw: raw}
+	if date, err := time.Parse(DATE_FORMAT, raw); err == nil {
+		field.Type = FIELD_DATE
+		field.Date = date.Format(DATE_FORMAT)
+	} else if d, ok := ParseDuration(raw); ok {
+		field.Type = FIELD_DURATION
+		field.Seconds = int64(d / time.Second)
+	} else if n, err := strconv.ParseFloat(raw, 64); err == nil {
+		field.Type = FIELD_NUMBER
+		field.Number = n
+	}
+	return field
+}
+
+// recurrenceEnd extends the value of a recurrence field starting at start
+// and ending at end by the following words, as long as the longer value is a
+// valid recurrence rule
+func recurrenceEnd(line string, start int, end int) int {
+	best := end
+	pos := end
+	for i := 0; i < maxRecurrenceWords; i++ {
+		word := wordRegex.FindStringIndex(line[pos:])
+		if word == nil {
+			break
+		}
+		pos += word[1]
+		if _, err := recur.Parse(line[start:pos]); err == nil {
+			best = pos
+		}
+	}
+	return best
+}
+
+// newKeyField works like NewField, but takes relative dates in DATE_FIELDS
+// for unresolved dates
+func newKeyField(key string, raw string) *Field {
+	field := NewField(raw)
+	if field.Type == FIELD_STRING && slices.Contains(DATE_FIELDS, key) && dates.IsRelative(raw) {
+		field.Type = FIELD_DATE
+		field.Relative = true
+	}
+	if field.Type == FIELD_DURATION && key == ESTIMATE_FIELD {
+		// estimates are working time
+		if d, ok := ParseEstimate(raw); ok {
+			field.Seconds = int64(d / time.Second)
+		}
+	}
+	return field
+}
+
+// Resolve sets the date of a relative date field to the date it refers to
+// from base
+func (f *Field) Resolve(base time.Time) {
+	if !f.Relative {
+		return
+	}
+	if date, ok := dates.Resolve(f.Raw, base); ok {
+		f.Date = date.Format(DATE_FORMAT)
+		f.Base = dates.Day(base).Format(DATE_FORMAT)
+	}
+}
+
+// ParseDuration parses durations like 2h, 1h30m or 3d. Days have 24 hours
+// and weeks 7 days.
+func ParseDuration(raw string) (time.Duration, bool) {
+	if !durationRegex.MatchString(raw) {
+		return 0, false
+	}
+	var total time.Duration
+	for _, part := range durationPartRegex.FindAllStringSubmatch(raw, -1) {
+		n, err := strconv.ParseFloat(part[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		total += time.Duration(n * float64(durationUnits[part[2]]))
+	}
+	return total, true
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// GROUP_KEYS are the values todos can be grouped by
+var GROUP_KEYS = []string{"state", "tag", "file", "heading", "assignee", "priority", "due"}
+
+// TodoGroup are the todos sharing the same value of a GROUP_KEY
+type TodoGroup struct {
+	// Key is the shared value, empty for the todos without one
+	Key   string  `json:"key"`
+	Todos []*Todo `json:"todos"`
+}
+
+// GroupTodos groups todos by one of the GROUP_KEYS. Groups are ordered by
+// their first todo, so sorted todos give sorted groups, and the group of todos
+// without a value comes last. Todos with several tags or assignees are part
+// of several groups. Files are relative to root and todoTag isn't a group.
+func GroupTodos(todos []*Todo, key string, root string, todoTag string) ([]*TodoGroup, error) {
+	var keys func(t *Todo) []string
+	switch key {
+	case "state":
+		keys = func(t *Todo) []string { return []string{t.StateString} }
+	case "tag":
+		todoTag = strings.TrimPrefix(todoTag, "#")
+		keys = func(t *Todo) []string {
+			tags := []string{}
+			for _, tag := range t.Tags {
+				if strings.TrimPrefix(tag, "#") != todoTag {
+					tags = append(tags, tag)
+				}
+			}
+			return tags
+		}
+	case "file":
+		keys = func(t *Todo) []string {
+			path, err := filepath.Rel(root, t.FilePath)
+			if root == "" || err != nil {
+				path = t.FilePath
+			}
+			return []string{path}
+		}
+	case "heading":
+		keys = func(t *Todo) []string { return []string{t.Heading} }
+	case "assignee":
+		keys = func(t *Todo) []string { return t.Assignees }
+	case "priority":
+		keys = func(t *Todo) []string {
+			if t.Priority == PRIORITY_NONE {
+				return nil
+			}
+			return []string{t.Priority.String()}
+		}
+	case "due":
+		keys = func(t *Todo) []string { return []string{t.DueDate} }
+	default:
+		return nil, fmt.Errorf("Unknown group key '%s', must be one of %v", key, GROUP_KEYS)
+	}
+
+	groups := []*TodoGroup{}
+	byKey := map[string]*TodoGroup{}
+	none := &TodoGroup{Key: "", Todos: []*Todo{}}
+	for _, todo := range todos {
+		found := false
+		for _, k := range keys(todo) {
+			if k == "" {
+				continue
+			}
+			found = true
+			group, ok := byKey[k]
+			if !ok {
+				group = &TodoGroup{Key: k, Todos: []*Todo{}}
+				byKey[k] = group
+				groups = append(groups, group)
+			}
+			group.Todos = append(group.Todos, todo)
+		}
+		if !found {
+			none.Todos = append(none.Todos, todo)
+		}
+	}
+	if len(none.Todos) > 0 {
+		groups = append(groups, none)
+	}
+	return groups, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupTodos(t *testing.T) {
+	todos := []*Todo{
+		parseTodo(t, "- [ ] #task #work review @alice priority:high"),
+		parseTodo(t, "- [x] #task #home #work clean @bob @alice"),
+		parseTodo(t, "- [ ] #task call the bank"),
+	}
+	todos[2].FilePath = "/vault/inbox.md"
+	todos[0].FilePath = "/vault/projects/plan.md"
+	todos[1].FilePath = "/vault/projects/plan.md"
+
+	tests := map[string]map[string][]int{
+		"tag":      {"#work": {0, 1}, "#home": {1}, "": {2}},
+		"assignee": {"alice": {0, 1}, "bob": {1}, "": {2}},
+		"priority": {"high": {0}, "": {1, 2}},
+		"file":     {"projects/plan.md": {0, 1}, "inbox.md": {2}},
+		"state":    {"OPEN": {0, 2}, "DONE": {1}},
+	}
+	order := map[string][]string{
+		"tag":      {"#work", "#home", ""},
+		"assignee": {"alice", "bob", ""},
+		"priority": {"high", ""},
+		"file":     {"projects/plan.md", "inbox.md"},
+		"state":    {"OPEN", "DONE"},
+	}
+	for key, want := range tests {
+		groups, err := GroupTodos(todos, key, "/vault", "task")
+		if err != nil {
+			t.Fatalf("GroupTodos(%q) error = %v", key, err)
+		}
+		keys := []string{}
+		got := map[string][]int{}
+		for _, group := range groups {
+			keys = append(keys, group.Key)
+			for _, todo := range group.Todos {
+				for i := range todos {
+					if todos[i] == todo {
+						got[group.Key] = append(got[group.Key], i)
+					}
+				}
+			}
+		}
+		if !reflect.DeepEqual(keys, order[key]) {
+			t.Errorf("GroupTodos(%q) keys = %v, want %v", key, keys, order[key])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GroupTodos(%q) = %v, want %v", key, got, want)
+		}
+	}
+
+	if _, err := GroupTodos(todos, "color", "", ""); err == nil {
+		t.Errorf("GroupTodos() with unknown key didn't fail")
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+// Note is the parsed content of a single markdown file
+type Note struct {
+	// Path is the path of the file the note was parsed from
+	Path string `json:"path"`
+	// Date is the date relative dates in the note are resolved against,
+	// empty when the note has none
+	Date string `json:"date,omitempty"`
+	// Mentions counts how often people are mentioned in the note, by name
+	// without the leading @
+	Mentions map[string]int `json:"mentions,omitempty"`
+	// Todos are all todos found in the note, in the order they appear
+	Todos []*Todo `json:"todos"`
+}
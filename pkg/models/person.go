@@ -0,0 +1,104 @@
+package models
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// mentionRegex matches mentions like @alice or @bob.smith. Like tags, the @
+// must start the line or follow whitespace or an opening bracket, so email
+// addresses are no mentions.
+var mentionRegex = regexp.MustCompile(`(?:^|[\s(\[{,;])@([\p{L}\p{N}_][\p{L}\p{N}_.-]*)`)
+
+// FindMentions returns the names of the people mentioned in line, without
+// the leading @, in the order they appear and without duplicates. Trailing .
+// and - are not part of a name.
+func FindMentions(line string) []string {
+	names := []string{}
+	for _, m := range mentionRegex.FindAllStringSubmatch(line, -1) {
+		name := strings.TrimRight(m[1], ".-")
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// HasAssignee reports whether name is assigned to the todo. The comparison
+// ignores case and the leading @ of name is optional.
+func (t *Todo) HasAssignee(name string) bool {
+	name = strings.TrimPrefix(name, "@")
+	for _, assignee := range t.Assignees {
+		if strings.EqualFold(assignee, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Person is someone mentioned in the vault
+type Person struct {
+	// Name is the name without the leading @
+	Name string `json:"name"`
+	// Mentions is the number of times the person is mentioned in all notes
+	Mentions int `json:"mentions"`
+	// Notes is the number of notes mentioning the person
+	Notes int `json:"notes"`
+	// Todos is the number of todos assigned to the person
+	Todos int `json:"todos"`
+	// Open is the part of Todos that isn't closed
+	Open int `json:"open"`
+}
+
+// BuildPeople collects everyone mentioned in notes, sorted by name. Names
+// that only differ in case are the same person, the spelling seen first
+// going through notes in order and their mentions sorted by name is kept.
+func BuildPeople(notes []*Note) []*Person {
+	people := map[string]*Person{}
+	person := func(name string) *Person {
+		key := strings.ToLower(name)
+		p, ok := people[key]
+		if !ok {
+			p = &Person{Name: name}
+			people[key] = p
+		}
+		return p
+	}
+
+	for _, note := range notes {
+		names := make([]string, 0, len(note.Mentions))
+		for name := range note.Mentions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		mentioned := map[*Person]bool{}
+		for _, name := range names {
+			p := person(name)
+			p.Mentions += note.Mentions[name]
+			if !mentioned[p] {
+				mentioned[p] = true
+				p.Notes++
+			}
+		}
+		for _, todo := range note.Todos {
+			for _, name := range todo.Assignees {
+				p := person(name)
+				p.Todos++
+				if !todo.Closed {
+					p.Open++
+				}
+			}
+		}
+	}
+
+	out := make([]*Person, 0, len(people))
+	for _, p := range people {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
+	})
+	return out
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindMentions(t *testing.T) {
+	line := "- [ ] #task ask @alice and @bob.smith. (@jörg) mail bob@example.org @alice"
+	want := []string{"alice", "bob.smith", "jörg"}
+	if got := FindMentions(line); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindMentions() = %v, want %v", got, want)
+	}
+}
+
+func TestHasAssignee(t *testing.T) {
+	todo := parseTodo(t, "- [ ] #task review @Alice")
+	for query, want := range map[string]bool{
+		"@alice": true,
+		"Alice":  true,
+		"@ali":   false,
+		"@bob":   false,
+	} {
+		if got := todo.HasAssignee(query); got != want {
+			t.Errorf("HasAssignee(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestBuildPeople(t *testing.T) {
+	notes := []*Note{
+		{
+			Mentions: map[string]int{"alice": 2, "bob": 1},
+			Todos: []*Todo{
+				parseTodo(t, "- [ ] #task ask @alice"),
+				parseTodo(t, "- [x] #task ask @alice and @bob"),
+			},
+		},
+		{
+			Mentions: map[string]int{"Alice": 1, "carol": 1},
+		},
+		{
+			// different spellings in one note count as one note
+			Mentions: map[string]int{"dave": 1, "Dave": 2, "DAVE": 1},
+		},
+	}
+
+	want := []*Person{
+		{Name: "alice", Mentions: 3, Notes: 2, Todos: 2, Open: 1},
+		{Name: "bob", Mentions: 1, Notes: 1, Todos: 1, Open: 0},
+		{Name: "carol", Mentions: 1, Notes: 1, Todos: 0, Open: 0},
+		{Name: "DAVE", Mentions: 4, Notes: 1, Todos: 0, Open: 0},
+	}
+	if got := BuildPeople(notes); !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildPeople() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Priority is the importance of a todo, higher is more important
+type Priority int
+
+const (
+	PRIORITY_NONE Priority = iota
+	PRIORITY_LOW
+	PRIORITY_MEDIUM
+	PRIORITY_HIGH
+)
+
+// DefaultPriorityEmoji are the priority markers of the obsidian tasks plugin
+var DefaultPriorityEmoji = map[string]Priority{
+	"🔺": PRIORITY_HIGH,
+	"⏫": PRIORITY_HIGH,
+	"🔼": PRIORITY_MEDIUM,
+	"🔽": PRIORITY_LOW,
+	"⏬": PRIORITY_LOW,
+}
+
+// bangRegex matches a standalone !, !! or !!!
+var bangRegex = regexp.MustCompile(`(?:^|\s)(!{1,3})(?:\s|$)`)
+
+// letterRegex matches a todo.txt style priority like (A)
+var letterRegex = regexp.MustCompile(`(?:^|\s)\(([A-Z])\)(?:\s|$)`)
+
+// ParsePriority parses names like high, medium and low, their first letter
+// or the todo.txt letters A, B and C
+func ParsePriority(name string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return PRIORITY_NONE, nil
+	case "low", "l", "c":
+		return PRIORITY_LOW, nil
+	case "medium", "m", "b":
+		return PRIORITY_MEDIUM, nil
+	case "high", "h", "a":
+		return PRIORITY_HIGH, nil
+	}
+	return PRIORITY_NONE, fmt.Errorf("Unknown priority: '%s'", name)
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PRIORITY_LOW:
+		return "low"
+	case PRIORITY_MEDIUM:
+		return "medium"
+	case PRIORITY_HIGH:
+		return "high"
+	}
+	return "none"
+}
+
+// findPriority determines the priority of a todo line. A valid priority:
+// field wins, otherwise the highest of the emoji, (A) and !! markers is taken.
+// fields must be the parsed fields of line.
+func findPriority(line string, fields map[string]*Field, emoji map[string]Priority) Priority {
+	if field, ok := fields["priority"]; ok {
+		if p, err := ParsePriority(field.Raw); err == nil {
+			return p
+		}
+	}
+
+	priority := PRIORITY_NONE
+	for marker, p := range emoji {
+		if p > priority && strings.Contains(line, marker) {
+			priority = p
+		}
+	}
+	if m := letterRegex.FindStringSubmatch(line); m != nil {
+		p := PRIORITY_LOW
+		if m[1] == "A" {
+			p = PRIORITY_HIGH
+		} else if m[1] == "B" {
+			p = PRIORITY_MEDIUM
+		}
+		if p > priority {
+			priority = p
+		}
+	}
+	if m := bangRegex.FindStringSubmatch(line); m != nil {
+		if p := Priority(len(m[1])); p > priority {
+			priority = p
+		}
+	}
+	return priority
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// markerFormat is the shape every state marker must have
+var markerFormat = regexp.MustCompile(`^\[.?\]$`)
+
+// State is a todo state and the markers that represent it in a note
+type State struct {
+	// Name of the state, eg: OPEN, DONE, IN_PROGRESS
+	Name string `json:"name" yaml:"name"`
+	// Markers map to this state. The first one is written when a todo is
+	// changed to the state
+	Markers []string `json:"markers" yaml:"markers"`
+	// Closed states count as finished, eg: DONE or CANCELLED
+	Closed bool `json:"closed" yaml:"closed"`
+	// Active states mark todos that are being worked on, eg: IN_PROGRESS.
+	// They raise the urgency of their todos
+	Active bool `json:"active" yaml:"active"`
+}
+
+// StateConfig is the vocabulary of todo states
+type StateConfig struct {
+	States []*State `json:"states"`
+	// Cycle is the order of state names to toggle through
+	Cycle []string `json:"cycle"`
+
+	byMarker map[string]*State
+	byName   map[string]*State
+}
+
+// DefaultStates are used when the config doesn't define any states
+var DefaultStates = []*State{
+	{Name: "OPEN", Markers: []string{"[ ]", "[]"}},
+	{Name: "IN_PROGRESS", Markers: []string{"[/]", "[-]"}, Active: true},
+	{Name: "DONE", Markers: []string{"[x]", "[X]"}, Closed: true},
+}
+
+// DefaultStateConfig holds the DefaultStates cycled in their order
+var DefaultStateConfig = mustStateConfig(NewStateConfig(nil, nil))
+
+// NewStateConfig validates states and cycle. Without states DefaultStates
+// are used, without a cycle all states are cycled in their order. The config
+// holds copies, states and cycle are left untouched.
+func NewStateConfig(states []*State, cycle []string) (*StateConfig, error) {
+	if len(states) == 0 {
+		states = DefaultStates
+	}
+
+	c := &StateConfig{
+		States:   make([]*State, 0, len(states)),
+		byMarker: map[string]*State{},
+		byName:   map[string]*State{},
+	}
+
+	for _, configured := range states {
+		state := *configured
+		state.Markers = append([]string{}, configured.Markers...)
+		state.Name = strings.ToUpper(state.Name)
+		if state.Name == "" {
+			return nil, fmt.Errorf("Todo state without a name")
+		}
+		if _, ok := c.byName[state.Name]; ok {
+			return nil, fmt.Errorf("Todo state %s is defined twice", state.Name)
+		}
+		if len(state.Markers) == 0 {
+			return nil, fmt.Errorf("Todo state %s has no markers", state.Name)
+		}
+		for _, marker := range state.Markers {
+			if !markerFormat.MatchString(marker) {
+				return nil, fmt.Errorf("Marker '%s' of state %s must look like [x]", marker, state.Name)
+			}
+			if other, ok := c.byMarker[marker]; ok {
+				return nil, fmt.Errorf("Marker '%s' is used by %s and %s", marker, other.Name, state.Name)
+			}
+			c.byMarker[marker] = &state
+		}
+		c.byName[state.Name] = &state
+		c.States = append(c.States, &state)
+	}
+
+	if len(cycle) == 0 {
+		for _, state := range c.States {
+			c.Cycle = append(c.Cycle, state.Name)
+		}
+	}
+	for _, name := range cycle {
+		upper := strings.ToUpper(name)
+		if _, ok := c.byName[upper]; !ok {
+			return nil, fmt.Errorf("Unknown todo state %s in cycle", name)
+		}
+		c.Cycle = append(c.Cycle, upper)
+	}
+
+	return c, nil
+}
+
+// ForMarker returns the state a marker maps to
+func (c *StateConfig) ForMarker(marker string) (*State, bool) {
+	state, ok := c.byMarker[marker]
+	return state, ok
+}
+
+// ForName returns the state with the given name
+func (c *StateConfig) ForName(name string) (*State, bool) {
+	state, ok := c.byName[strings.ToUpper(name)]
+	return state, ok
+}
+
+// Resolve returns the state for a state name or a marker
+func (c *StateConfig) Resolve(nameOrMarker string) (*State, error) {
+	if state, ok := c.ForName(nameOrMarker); ok {
+		return state, nil
+	}
+	if state, ok := c.ForMarker(nameOrMarker); ok {
+		return state, nil
+	}
+	return nil, fmt.Errorf("Unknown todo state: '%s'", nameOrMarker)
+}
+
+// IsClosed reports whether the state with the given name counts as finished
+func (c *StateConfig) IsClosed(name string) bool {
+	state, ok := c.ForName(name)
+	return ok && state.Closed
+}
+
+// Next returns the state following name in the cycle. States that are not
+// part of the cycle continue with its first state.
+func (c *StateConfig) Next(name string) *State {
+	name = strings.ToUpper(name)
+	next := c.Cycle[0]
+	for i, n := range c.Cycle {
+		if n == name {
+			next = c.Cycle[(i+1)%len(c.Cycle)]
+			break
+		}
+	}
+	return c.byName[next]
+}
+
+func mustStateConfig(c *StateConfig, err error) *StateConfig {
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testStates() []*State {
+	return []*State{
+		{Name: "open", Markers: []string{"[ ]"}},
+		{Name: "in_progress", Markers: []string{"[/]"}, Active: true},
+		{Name: "deferred", Markers: []string{"[>]"}},
+		{Name: "done", Markers: []string{"[x]", "[X]"}, Closed: true},
+		{Name: "cancelled", Markers: []string{"[~]"}, Closed: true},
+	}
+}
+
+func TestNewStateConfig(t *testing.T) {
+	states := testStates()
+	cycle := []string{"open", "in_progress", "done"}
+	c, err := NewStateConfig(states, cycle)
+	if err != nil {
+		t.Fatalf("NewStateConfig() error = %v", err)
+	}
+
+	if states[0].Name != "open" || cycle[0] != "open" {
+		t.Errorf("NewStateConfig() changed its arguments: %s, %v", states[0].Name, cycle)
+	}
+	if c.States[0].Name != "OPEN" || c.States[0] == states[0] {
+		t.Errorf("NewStateConfig() didn't copy the states")
+	}
+	if want := []string{"OPEN", "IN_PROGRESS", "DONE"}; !reflect.DeepEqual(c.Cycle, want) {
+		t.Errorf("Cycle = %v, want %v", c.Cycle, want)
+	}
+	if DefaultStates[0].Name != "OPEN" || len(DefaultStateConfig.Cycle) != len(DefaultStates) {
+		t.Errorf("DefaultStates changed")
+	}
+}
+
+func TestNewStateConfigErrors(t *testing.T) {
+	tests := map[string]struct {
+		states []*State
+		cycle  []string
+	}{
+		"no name":          {[]*State{{Markers: []string{"[ ]"}}}, nil},
+		"duplicate name":   {[]*State{{Name: "OPEN", Markers: []string{"[ ]"}}, {Name: "open", Markers: []string{"[o]"}}}, nil},
+		"no markers":       {[]*State{{Name: "OPEN"}}, nil},
+		"invalid marker":   {[]*State{{Name: "OPEN", Markers: []string{"( )"}}}, nil},
+		"long marker":      {[]*State{{Name: "OPEN", Markers: []string{"[  ]"}}}, nil},
+		"duplicate marker": {[]*State{{Name: "OPEN", Markers: []string{"[ ]"}}, {Name: "TODO", Markers: []string{"[ ]"}}}, nil},
+		"unknown in cycle": {testStates(), []string{"open", "waiting"}},
+	}
+	for name, tt := range tests {
+		if _, err := NewStateConfig(tt.states, tt.cycle); err == nil {
+			t.Errorf("%s: NewStateConfig() didn't fail", name)
+		}
+	}
+}
+
+func TestStateConfig_Resolve(t *testing.T) {
+	c, err := NewStateConfig(testStates(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]string{
+		"OPEN":     "OPEN",
+		"deferred": "DEFERRED",
+		"[X]":      "DONE",
+		"[~]":      "CANCELLED",
+		"[?]":      "",
+		"WAITING":  "",
+	} {
+		state, err := c.Resolve(query)
+		if want == "" {
+			if err == nil {
+				t.Errorf("Resolve(%q) = %s, want an error", query, state.Name)
+			}
+			continue
+		}
+		if err != nil || state.Name != want {
+			t.Errorf("Resolve(%q) = %v, %v, want %s", query, state, err, want)
+		}
+	}
+}
+
+func TestStateConfig_Next(t *testing.T) {
+	c, err := NewStateConfig(testStates(), []string{"open", "in_progress", "done"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"OPEN":        "IN_PROGRESS",
+		"in_progress": "DONE",
+		"DONE":        "OPEN",
+		// states outside of the cycle start it over
+		"DEFERRED": "OPEN",
+	} {
+		if got := c.Next(name).Name; got != want {
+			t.Errorf("Next(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
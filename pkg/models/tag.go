@@ -0,0 +1,135 @@
+package models
+
+import (
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// TAG_SEPARATOR separates the levels of hierarchical tags like #project/alpha
+const TAG_SEPARATOR = "/"
+
+// tagRegex matches tags made of unicode letters, digits, _, - and /. The #
+// must start the line or follow whitespace or an opening bracket, so
+// anchors in links like [[note#heading]] are no tags.
+var tagRegex = regexp.MustCompile(`(?:^|[\s(\[{,;])(#[\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+
+// FindTags returns the tags in line in the order they appear, without
+// duplicates. Trailing / and - are not part of a tag.
+func FindTags(line string) []string {
+	tags := []string{}
+	for _, m := range tagRegex.FindAllStringSubmatch(line, -1) {
+		tag := strings.TrimRight(m[1], "/-")
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// TagMatches reports whether tag is query or nested below it, so #project
+// matches #project and #project/alpha, but not #projects. The comparison
+// ignores case and the leading # of query is optional.
+func TagMatches(tag string, query string) bool {
+	tag = strings.ToLower(tag)
+	query = strings.ToLower(query)
+	if !strings.HasPrefix(query, "#") {
+		query = "#" + query
+	}
+	return tag == query || strings.HasPrefix(tag, query+TAG_SEPARATOR)
+}
+
+// HasTag reports whether one of the tags of the todo matches query, see
+// TagMatches
+func (t *Todo) HasTag(query string) bool {
+	for _, tag := range t.Tags {
+		if TagMatches(tag, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// InheritedTags returns the tags of the todo followed by those of the todos
+// it is nested in, without duplicates. Reports use them to credit subtasks
+// to the tags of their parents.
+func (t *Todo) InheritedTags() []string {
+	tags := []string{}
+	for todo := t; todo != nil; todo = todo.Parent {
+		for _, tag := range todo.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// TagNode is a level of the tag hierarchy
+type TagNode struct {
+	// Name is the last segment of the tag, eg: alpha for #project/alpha
+	Name string `json:"name"`
+	// Tag is the complete tag, eg: #project/alpha
+	Tag string `json:"tag"`
+	// Count is the number of todos tagged with the tag or a tag below it
+	Count int `json:"count"`
+	// Open is the part of Count that isn't closed
+	Open int `json:"open"`
+	// Children are the tags one level below, sorted by name
+	Children []*TagNode `json:"children"`
+
+	counted map[*Todo]bool
+}
+
+// BuildTagTree arranges the tags of todos in their hierarchy and counts the
+// todos below every level. Like TagMatches it ignores case, nodes are named
+// like the tag they were first seen in. The top level tags are returned
+// sorted by name.
+func BuildTagTree(todos []*Todo) []*TagNode {
+	root := &TagNode{}
+	for _, todo := range todos {
+		for _, tag := range todo.Tags {
+			node := root
+			segments := strings.Split(strings.TrimPrefix(tag, "#"), TAG_SEPARATOR)
+			for i, segment := range segments {
+				node = node.child(segment, "#"+strings.Join(segments[:i+1], TAG_SEPARATOR))
+				node.count(todo)
+			}
+		}
+	}
+	root.sort()
+	return root.Children
+}
+
+func (n *TagNode) child(name string, tag string) *TagNode {
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	c := &TagNode{Name: name, Tag: tag, Children: []*TagNode{}, counted: map[*Todo]bool{}}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// count adds todo to the counts, unless another tag of it was counted already
+func (n *TagNode) count(todo *Todo) {
+	if n.counted[todo] {
+		return
+	}
+	n.counted[todo] = true
+	n.Count++
+	if !todo.Closed {
+		n.Open++
+	}
+}
+
+func (n *TagNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return strings.ToLower(n.Children[i].Name) < strings.ToLower(n.Children[j].Name)
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindTags(t *testing.T) {
+	line := "- [ ] #task fix #project/alpha/backend (#größe) #a-b/ see [[note#heading]] C# #task"
+	want := []string{"#task", "#project/alpha/backend", "#größe", "#a-b"}
+	if got := FindTags(line); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindTags() = %v, want %v", got, want)
+	}
+}
+
+func TestTagMatches(t *testing.T) {
+	tests := []struct {
+		tag   string
+		query string
+		want  bool
+	}{
+		{"#project", "#project", true},
+		{"#project/alpha", "#project", true},
+		{"#project/alpha/backend", "project/alpha", true},
+		{"#Project/Alpha", "#project/alpha", true},
+		{"#projects", "#project", false},
+		{"#project", "#project/alpha", false},
+	}
+	for _, tt := range tests {
+		if got := TagMatches(tt.tag, tt.query); got != tt.want {
+			t.Errorf("TagMatches(%q, %q) = %v, want %v", tt.tag, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestInheritedTags(t *testing.T) {
+	epic := parseTodo(t, "- [ ] #task #project big")
+	sub := &Todo{RawLine: "  - [ ] sub #backend #project", LineNumber: 2, FilePath: "note.md"}
+	epic.AddChild(sub)
+	subsub := &Todo{RawLine: "    - [ ] subsub", LineNumber: 3, FilePath: "note.md"}
+	sub.AddChild(subsub)
+	for _, todo := range []*Todo{sub, subsub} {
+		if err := todo.Parse(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(subsub.Tags) != 0 {
+		t.Errorf("Tags = %v, want none", subsub.Tags)
+	}
+	want := []string{"#backend", "#project", "#task"}
+	if got := subsub.InheritedTags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("InheritedTags() = %v, want %v", got, want)
+	}
+}
+
+func TestBuildTagTree(t *testing.T) {
+	todos := []*Todo{
+		parseTodo(t, "- [ ] #task #project/alpha #project/alpha/backend"),
+		parseTodo(t, "- [x] #task #project/beta"),
+	}
+
+	tree := BuildTagTree(todos)
+	if len(tree) != 2 || tree[0].Tag != "#project" || tree[1].Tag != "#task" {
+		t.Fatalf("unexpected top level %+v", tree)
+	}
+	project := tree[0]
+	if project.Count != 2 || project.Open != 1 {
+		t.Errorf("#project counts %d todos, %d open", project.Count, project.Open)
+	}
+	alpha := project.Children[0]
+	if alpha.Tag != "#project/alpha" || alpha.Count != 1 || alpha.Children[0].Name != "backend" {
+		t.Errorf("unexpected #project/alpha node %+v", alpha)
+	}
+}
+
+func TestBuildTagTreeIgnoresCase(t *testing.T) {
+	todos := []*Todo{
+		parseTodo(t, "- [ ] #task #Project/alpha"),
+		parseTodo(t, "- [ ] #task #project/Alpha"),
+		parseTodo(t, "- [ ] #task #project/beta"),
+	}
+
+	tree := BuildTagTree(todos)
+	if len(tree) != 2 || tree[0].Tag != "#Project" || tree[0].Count != 3 {
+		t.Fatalf("unexpected top level %+v", tree)
+	}
+	children := tree[0].Children
+	if len(children) != 2 || children[0].Tag != "#Project/alpha" || children[0].Count != 2 || children[1].Name != "beta" {
+		t.Errorf("unexpected children of #Project %+v %+v", children[0], children[1])
+	}
+}
@@ -1,58 +1,295 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/recur"
 )
 
-var STATE_MAP = map[string]string{
-	"[]":  "OPEN",
-	"[ ]": "OPEN",
-	"[-]": "IN_PROGRESS",
-	"[/]": "IN_PROGRESS",
-	"[x]": "DONE",
-	"[X]": "DONE",
-}
+// ANCHOR_PREFIX starts the block anchors granite generates for todos
+const ANCHOR_PREFIX = "t-"
+
+var stateRegex = regexp.MustCompile(`(\[.?\])`)
+
+// doneFieldRegex matches the done: stamp in both field syntaxes
+var doneFieldRegex = regexp.MustCompile(`(?i)(?:^|\s)done:\S+|\[done::[^\]]*\]`)
+
+// anchorRegex matches a block anchor like ^t-abc123 at the end of a line
+var anchorRegex = regexp.MustCompile(`\s\^([A-Za-z0-9][A-Za-z0-9-]*)\s*$`)
 
 type Todo struct {
+	// ID identifies the todo across edits. It is the block anchor of the todo
+	// if it has one, a fingerprint of its file and text otherwise
+	ID string `json:"id"`
+	// Anchor is the explicit block anchor of the todo without the leading ^
+	Anchor string `json:"anchor,omitempty"`
 	// RawLine is the complete unparse line from the markdown file
 	RawLine string
 	// Text contains the todo string without leading whitespace and -
 	Text string `json:"text"`
-	// Tags are the tags assigned to the todo
+	// Tags are the tags written on the line of the todo. Subtasks don't
+	// inherit the tags of their parent, ParentID links them to it. See
+	// InheritedTags for the tags of the todos it is nested in.
 	Tags []string `json:"tags"`
+	// Assignees are the names of the people mentioned on the line of the
+	// todo, like alice for @alice. Subtasks don't inherit the assignees of
+	// their parent.
+	Assignees []string `json:"assignees,omitempty"`
 	// LineNumber is the line in the file where the todo was found
 	LineNumber int `json:"lnum"`
+	// EndLineNumber is the last line of the list item of the todo, including its subtasks
+	EndLineNumber int `json:"end_lnum"`
+	// Body is the complete list item without the list marker and indentation,
+	// including continuation lines and nested content
+	Body string `json:"body"`
+	// Notes is the content attached to the todo below its first paragraph,
+	// for example sub bullets or code blocks. Subtasks are not part of the notes
+	Notes string `json:"notes,omitempty"`
 	// FilePath is the path to the file where the todo was found
 	FilePath string `json:"filename"`
-	// DueDate is the date when the todo is due. The format must be YYYY-MM-DD
+	// DueDate is the date when the todo is due, taken from its due: field. The format is YYYY-MM-DD.
+	// Relative due dates are resolved against the date of the note
 	DueDate string `json:"due_date"`
+	// CreatedDate is the date of the created: field, formatted as YYYY-MM-DD
+	CreatedDate string `json:"created_date,omitempty"`
+	// CompletedDate is the date of the done: field granite stamps when the
+	// todo is closed, formatted as YYYY-MM-DD
+	CompletedDate string `json:"completed_date,omitempty"`
+	// EstimateSeconds is the working time of the estimate: field or the ~
+	// shorthand, like ~2d
+	EstimateSeconds int64 `json:"estimate_seconds,omitempty"`
+	// Effort is the estimated work of the todo and its subtasks, set by
+	// RollUpEstimates
+	Effort Effort `json:"effort"`
+	// Heading is the text of the heading the todo is placed under
+	Heading string `json:"heading,omitempty"`
+	// TaskID is the value of the id: field other todos reference as dependency
+	TaskID string `json:"task_id,omitempty"`
+	// DependsOn are the references of the after: and blocked-by: fields
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Blocked is true while a dependency of the todo is open. Like
+	// Actionable, BlockedBy and DependencyErrors it is only set on todos
+	// returned by queries
+	Blocked bool `json:"blocked"`
+	// Actionable is true for open todos that aren't blocked
+	Actionable bool `json:"actionable"`
+	// BlockedBy are the references of the open dependencies
+	BlockedBy []string `json:"blocked_by,omitempty"`
+	// DependencyErrors describe unknown references, duplicate ids and cycles
+	DependencyErrors []string `json:"dependency_errors,omitempty"`
+	// Clocks are the org mode style CLOCK: entries below the todo, newest first
+	Clocks []*Clock `json:"clocks,omitempty"`
+	// TrackedSeconds is the time of all stopped clocks of the todo
+	TrackedSeconds int64 `json:"tracked_seconds"`
+	// Fields are the inline key value fields of the todo, eg: due:2024-05-01 or [estimate:: 2h]
+	Fields map[string]*Field `json:"fields"`
+	// Recurrence is the rule of the every: or rrule: field of recurring todos
+	Recurrence *recur.Rule `json:"recurrence,omitempty"`
+	// Priority is the importance of the todo, from 0 (none) to 3 (high)
+	Priority Priority `json:"priority"`
+	// Urgency scores how pressing the todo is. It depends on the current date
+	// and is only set on todos returned by queries
+	Urgency float64 `json:"urgency"`
 	// StateString is a string representation of the State of the ToDo, eg: OPEN, DONE, IN_PROGRESS
 	StateString string `json:"state"`
+	// Closed is true when the state of the todo counts as finished
+	Closed bool `json:"closed"`
+	// Depth is the number of todos this todo is nested in. Top level todos have a depth of 0
+	Depth int `json:"depth"`
+	// List is the markdown list the todo is an item of
+	List *ListRef `json:"list,omitempty"`
+	// Range is the span of the list item of the todo in the file
+	Range Range `json:"range"`
+	// MarkerRange is the span of the state marker, eg: [ ]
+	MarkerRange Range `json:"marker_range"`
+	// ParentID is the ID of the todo this todo is a subtask of
+	ParentID string `json:"parent_id,omitempty"`
+	// ParentLineNumber is the line of the todo this todo is a subtask of, 0 for top level todos
+	ParentLineNumber int `json:"parent_lnum,omitempty"`
+	// ChildLineNumbers are the lines of the direct subtasks of this todo
+	ChildLineNumbers []int `json:"children_lnum,omitempty"`
+	// Parent is the todo this todo is a subtask of
+	Parent *Todo `json:"-"`
+	// Children are the direct subtasks of this todo
+	Children []*Todo `json:"-"`
+}
+
+// Range is a span of text in a file. Lines are 1 based, columns and bytes
+// are 0 based offsets and the end is exclusive.
+type Range struct {
+	StartByte int `json:"start_byte"`
+	EndByte   int `json:"end_byte"`
+	StartLine int `json:"lnum"`
+	StartCol  int `json:"col"`
+	EndLine   int `json:"end_lnum"`
+	EndCol    int `json:"end_col"`
+}
+
+// ListRef describes the markdown list enclosing a todo
+type ListRef struct {
+	// LineNumber is the first line of the list
+	LineNumber int `json:"lnum"`
+	// EndLineNumber is the last line of the list
+	EndLineNumber int `json:"end_lnum"`
+	// Ordered is true for numbered lists
+	Ordered bool `json:"ordered"`
+}
+
+// AddChild makes child a subtask of t
+func (t *Todo) AddChild(child *Todo) {
+	child.Parent = t
+	child.ParentLineNumber = t.LineNumber
+	child.ParentID = t.ID
+	t.Children = append(t.Children, child)
+	t.ChildLineNumbers = append(t.ChildLineNumbers, child.LineNumber)
+}
+
+// LinkTodos restores the Parent and Children pointers of todos from the same
+// file, for example after they were decoded from json
+func LinkTodos(todos []*Todo) {
+	byLine := map[int]*Todo{}
+	for _, t := range todos {
+		byLine[t.LineNumber] = t
+		t.Parent = nil
+		t.Children = nil
+	}
+	for _, t := range todos {
+		if parent, ok := byLine[t.ParentLineNumber]; ok && t.ParentLineNumber != 0 {
+			t.Parent = parent
+			parent.Children = append(parent.Children, t)
+		}
+	}
+}
+
+// ParseOptions configure how the line of a todo is interpreted
+type ParseOptions struct {
+	// States maps state markers to states. Defaults to DefaultStateConfig
+	States *StateConfig
+	// PriorityEmoji maps emoji to the priority they mark. Defaults to DefaultPriorityEmoji
+	PriorityEmoji map[string]Priority
 }
 
 // Parse parses the RawLine set in the todo and populates all other fields based on what it finds there.
+// Subtasks, todos with a Parent, don't need tags. States are taken from
+// DefaultStateConfig.
 //
 // Returns an error when RawLine, LineNumber or FilePath are unset or the RawLine can't be parsed into a todo
 func (t *Todo) Parse() error {
-	stateRegex := regexp.MustCompile(`(\[.?\])`)
-	tagsRegex := regexp.MustCompile(`(#\w+)`)
-	dateRegex := regexp.MustCompile(`(\d{4}-\d{2}-\d{2})`)
+	return t.ParseWith(ParseOptions{})
+}
+
+// ParseWith works like Parse, but interprets the line using opts
+func (t *Todo) ParseWith(opts ParseOptions) error {
+	states := opts.States
+	if states == nil {
+		states = DefaultStateConfig
+	}
+	emoji := opts.PriorityEmoji
+	if emoji == nil {
+		emoji = DefaultPriorityEmoji
+	}
+
 	textRegex := regexp.MustCompile(`^.*(\[.?\].*)$`)
 
 	stateRaw := stateRegex.FindString(t.RawLine)
-	stateString, ok := STATE_MAP[stateRaw]
+	state, ok := states.ForMarker(stateRaw)
 	if !ok {
 		return fmt.Errorf("Couldn't parse todo state: '%s', line is: '%s'", stateRaw, t.RawLine)
 	}
 
-	t.StateString = stateString
-	t.Tags = tagsRegex.FindAllString(t.RawLine, 100)
-	if len(t.Tags) == 0 {
+	t.StateString = state.Name
+	t.Closed = state.Closed
+	t.Tags = FindTags(t.RawLine)
+	if len(t.Tags) == 0 && t.Parent == nil {
 		return fmt.Errorf("Couldn't parse todo Tags: %s", t.RawLine)
 	}
+	t.Assignees = FindMentions(t.RawLine)
 
-	t.DueDate = dateRegex.FindString(t.RawLine)
+	t.Fields = ParseFields(t.RawLine)
+	t.setDueDate()
+	t.CreatedDate = t.fieldDate("created")
+	t.CompletedDate = t.fieldDate("done")
+	t.Priority = findPriority(t.RawLine, t.Fields, emoji)
+	t.parseDependencies()
+	t.parseEstimate()
+	t.Recurrence = nil
+	for _, key := range RECURRENCE_FIELDS {
+		if field, ok := t.Fields[key]; ok {
+			if rule, err := recur.Parse(field.Raw); err == nil {
+				t.Recurrence = rule
+				break
+			}
+		}
+	}
 	t.Text = textRegex.FindStringSubmatch(t.RawLine)[1]
+
+	if anchor := anchorRegex.FindStringSubmatch(t.RawLine); anchor != nil {
+		t.Anchor = anchor[1]
+		t.ID = anchor[1]
+		t.Text = strings.TrimSpace(anchorRegex.ReplaceAllString(t.Text, ""))
+	}
 	return nil
 }
+
+// AnchorSpan returns the byte offsets of the block anchor in RawLine,
+// including the whitespace in front of it
+func (t *Todo) AnchorSpan() (start int, end int, ok bool) {
+	loc := anchorRegex.FindStringIndex(t.RawLine)
+	if loc == nil {
+		return 0, 0, false
+	}
+	return loc[0], loc[1], true
+}
+
+// ResolveDates resolves the relative date fields of the todo against base
+func (t *Todo) ResolveDates(base time.Time) {
+	for _, field := range t.Fields {
+		field.Resolve(base)
+	}
+	t.setDueDate()
+}
+
+// HasUnresolvedDates reports whether the todo has relative date fields that
+// aren't resolved yet
+func (t *Todo) HasUnresolvedDates() bool {
+	for _, field := range t.Fields {
+		if field.Relative && field.Date == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Todo) setDueDate() {
+	t.DueDate = t.fieldDate("due")
+}
+
+// fieldDate returns the date of the field key, or an empty string when the
+// todo has no such date field
+func (t *Todo) fieldDate(key string) string {
+	if field, ok := t.Fields[key]; ok && field.Type == FIELD_DATE {
+		return field.Date
+	}
+	return ""
+}
+
+// Fingerprint derives an ID from the file and the text of the todo. The state
+// marker and the done: stamp are left out, so the fingerprint survives state
+// changes, and so are lines above the todo. occurrence tells apart todos with
+// the same text in the same file.
+func (t *Todo) Fingerprint(occurrence int) string {
+	text := t.Text
+	if loc := stateRegex.FindStringIndex(text); loc != nil && loc[0] == 0 {
+		text = text[loc[1]:]
+	}
+	text = doneFieldRegex.ReplaceAllString(text, " ")
+	text = strings.Join(strings.Fields(text), " ")
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", t.FilePath, text, occurrence)))
+	return "fp-" + hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/dates"
+)
+
+// UrgencyCoefficients weigh the terms of the urgency score. The defaults
+// follow taskwarrior.
+type UrgencyCoefficients struct {
+	// PriorityHigh, PriorityMedium and PriorityLow are added for the priority of the todo
+	PriorityHigh   float64 `json:"priority_high" yaml:"priority_high"`
+	PriorityMedium float64 `json:"priority_medium" yaml:"priority_medium"`
+	PriorityLow    float64 `json:"priority_low" yaml:"priority_low"`
+	// Due is scaled from 0.2, due in 14 days or later, to 1, overdue for 7 days or more
+	Due float64 `json:"due" yaml:"due"`
+	// Scheduled is added once the scheduled date is reached
+	Scheduled float64 `json:"scheduled" yaml:"scheduled"`
+	// Age is scaled by the age of the todo in years, up to one year
+	Age float64 `json:"age" yaml:"age"`
+	// Tags is scaled by the number of tags, 0.8 for one, 0.9 for two, 1 for more
+	Tags float64 `json:"tags" yaml:"tags"`
+	// Active is added for todos in an active state
+	Active float64 `json:"active" yaml:"active"`
+	// Next is added for todos tagged with #next
+	Next float64 `json:"next" yaml:"next"`
+}
+
+// DefaultUrgency holds the taskwarrior coefficients
+var DefaultUrgency = UrgencyCoefficients{
+	PriorityHigh:   6,
+	PriorityMedium: 3.9,
+	PriorityLow:    1.8,
+	Due:            12,
+	Scheduled:      5,
+	Age:            2,
+	Tags:           1,
+	Active:         4,
+	Next:           15,
+}
+
+// SORT_KEYS are the orders todos can be sorted in
+var SORT_KEYS = []string{"urgency", "due", "priority", "file", "state"}
+
+// UrgencyAt scores how pressing the todo is at now. Closed todos have no
+// urgency. The state of the todo is looked up in states to tell whether it is
+// active.
+func (t *Todo) UrgencyAt(now time.Time, c UrgencyCoefficients, states *StateConfig) float64 {
+	if t.Closed {
+		return 0
+	}
+	today := dates.Day(now)
+	urgency := 0.0
+
+	switch t.Priority {
+	case PRIORITY_HIGH:
+		urgency += c.PriorityHigh
+	case PRIORITY_MEDIUM:
+		urgency += c.PriorityMedium
+	case PRIORITY_LOW:
+		urgency += c.PriorityLow
+	}
+
+	if due, err := time.Parse(DATE_FORMAT, t.DueDate); err == nil {
+		overdue := today.Sub(due).Hours() / 24
+		factor := 0.2
+		if overdue >= 7 {
+			factor = 1
+		} else if overdue >= -14 {
+			factor = (overdue+14)*0.8/21 + 0.2
+		}
+		urgency += factor * c.Due
+	}
+
+	if scheduled, ok := t.Fields["scheduled"]; ok && scheduled.Type == FIELD_DATE {
+		if date, err := time.Parse(DATE_FORMAT, scheduled.Date); err == nil && !date.After(today) {
+			urgency += c.Scheduled
+		}
+	}
+
+	if t.CreatedDate != "" {
+		if date, err := time.Parse(DATE_FORMAT, t.CreatedDate); err == nil && date.Before(today) {
+			age := today.Sub(date).Hours() / 24 / 365
+			if age > 1 {
+				age = 1
+			}
+			urgency += age * c.Age
+		}
+	}
+
+	switch len(t.Tags) {
+	case 0:
+	case 1:
+		urgency += 0.8 * c.Tags
+	case 2:
+		urgency += 0.9 * c.Tags
+	default:
+		urgency += c.Tags
+	}
+
+	if states != nil {
+		if state, ok := states.ForName(t.StateString); ok && state.Active {
+			urgency += c.Active
+		}
+	}
+
+	if slices.Contains(t.Tags, "#next") {
+		urgency += c.Next
+	}
+
+	return urgency
+}
+
+// SortTodos sorts todos in place by one of the SORT_KEYS. Urgency and
+// priority sort descending, due dates ascending with undated todos last and
+// states in the order of states. Ties keep their order.
+func SortTodos(todos []*Todo, key string, states *StateConfig) error {
+	var less func(a, b *Todo) bool
+	switch key {
+	case "urgency":
+		less = func(a, b *Todo) bool { return a.Urgency > b.Urgency }
+	case "due":
+		less = func(a, b *Todo) bool {
+			if a.DueDate == "" || b.DueDate == "" {
+				return a.DueDate != ""
+			}
+			return a.DueDate < b.DueDate
+		}
+	case "priority":
+		less = func(a, b *Todo) bool { return a.Priority > b.Priority }
+	case "file":
+		less = func(a, b *Todo) bool {
+			if a.FilePath != b.FilePath {
+				return a.FilePath < b.FilePath
+			}
+			return a.LineNumber < b.LineNumber
+		}
+	case "state":
+		order := map[string]int{}
+		for i, state := range states.States {
+			order[state.Name] = i
+		}
+		less = func(a, b *Todo) bool { return order[a.StateString] < order[b.StateString] }
+	default:
+		return fmt.Errorf("Unknown sort key '%s', must be one of %v", key, SORT_KEYS)
+	}
+
+	sort.SliceStable(todos, func(i, j int) bool {
+		return less(todos[i], todos[j])
+	})
+	return nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTodo(t *testing.T, line string) *Todo {
+	t.Helper()
+	todo := &Todo{RawLine: line, LineNumber: 1, FilePath: "note.md"}
+	if err := todo.Parse(); err != nil {
+		t.Fatalf("Parse(%q) error = %v", line, err)
+	}
+	return todo
+}
+
+func TestPriority(t *testing.T) {
+	tests := map[string]Priority{
+		"- [ ] #task plain":                PRIORITY_NONE,
+		"- [ ] #task priority:high":        PRIORITY_HIGH,
+		"- [ ] #task [priority:: low] !!!": PRIORITY_LOW,
+		"- [ ] #task (B) todo.txt style":   PRIORITY_MEDIUM,
+		"- [ ] #task !! bangs":             PRIORITY_MEDIUM,
+		"- [ ] #task not!! a priority":     PRIORITY_NONE,
+		"- [ ] #task emoji 🔽 and (A)":      PRIORITY_HIGH,
+		"- [ ] #task emoji ⏫":              PRIORITY_HIGH,
+		"- [ ] #task priority:unknown 🔼":   PRIORITY_MEDIUM,
+	}
+	for line, want := range tests {
+		if got := parseTodo(t, line).Priority; got != want {
+			t.Errorf("priority of %q = %s, want %s", line, got, want)
+		}
+	}
+}
+
+func TestSortByUrgency(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	todos := []*Todo{
+		parseTodo(t, "- [ ] #task someday"),
+		parseTodo(t, "- [x] #task done priority:high due:2024-04-01"),
+		parseTodo(t, "- [ ] #task overdue due:2024-04-20"),
+		parseTodo(t, "- [ ] #task important priority:high"),
+		parseTodo(t, "- [/] #task started"),
+		parseTodo(t, "- [ ] #task #next up next"),
+	}
+	for _, todo := range todos {
+		todo.Urgency = todo.UrgencyAt(now, DefaultUrgency, DefaultStateConfig)
+	}
+
+	if err := SortTodos(todos, "urgency", DefaultStateConfig); err != nil {
+		t.Fatalf("SortTodos() error = %v", err)
+	}
+
+	want := []string{"up next", "overdue", "important", "started", "someday", "done"}
+	for i, todo := range todos {
+		if !strings.Contains(todo.Text, want[i]) {
+			t.Errorf("todo %d is %q (urgency %.2f), want %q", i, todo.Text, todo.Urgency, want[i])
+		}
+	}
+	if todos[len(todos)-1].Urgency != 0 {
+		t.Errorf("closed todo has urgency %f", todos[len(todos)-1].Urgency)
+	}
+
+	if err := SortTodos(todos, "nonsense", DefaultStateConfig); err == nil {
+		t.Errorf("SortTodos() accepted an unknown key")
+	}
+}
+
+func TestUrgencyActiveStates(t *testing.T) {
+	states, err := NewStateConfig(append(testStates(), &State{Name: "QUESTION", Markers: []string{"[?]"}}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	urgency := func(line string) float64 {
+		todo := &Todo{RawLine: line, LineNumber: 1, FilePath: "note.md"}
+		if err := todo.ParseWith(ParseOptions{States: states}); err != nil {
+			t.Fatal(err)
+		}
+		return todo.UrgencyAt(now, DefaultUrgency, states)
+	}
+
+	open := urgency("- [ ] #task plain")
+	if got := urgency("- [/] #task plain"); got != open+DefaultUrgency.Active {
+		t.Errorf("active todo has urgency %.2f, want %.2f", got, open+DefaultUrgency.Active)
+	}
+	for _, line := range []string{"- [>] #task plain", "- [?] #task plain"} {
+		if got := urgency(line); got != open {
+			t.Errorf("urgency of %q = %.2f, want %.2f like open todos", line, got, open)
+		}
+	}
+}
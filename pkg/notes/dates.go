@@ -0,0 +1,97 @@
+package notes
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/dates"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ANCHOR_DAILY_NOTE takes the date from the file name of daily notes
+	ANCHOR_DAILY_NOTE = "daily_note"
+	// ANCHOR_CREATED takes the created or date key of the front matter
+	ANCHOR_CREATED = "created"
+	// ANCHOR_TODAY resolves relative dates against the current date when
+	// todos are queried
+	ANCHOR_TODAY = "today"
+)
+
+// DATE_ANCHORS are all sources relative dates can be resolved against
+var DATE_ANCHORS = []string{ANCHOR_DAILY_NOTE, ANCHOR_CREATED, ANCHOR_TODAY}
+
+// DefaultDateAnchors are tried in this order when the config doesn't set any
+var DefaultDateAnchors = DATE_ANCHORS
+
+// DefaultDailyNoteFormat is the go time layout of daily note file names
+const DefaultDailyNoteFormat = "2006-01-02"
+
+// frontMatterDateKeys are looked up in the front matter, in this order
+var frontMatterDateKeys = []string{"created", "date"}
+
+// ValidateDateAnchors returns an error for anchors that aren't part of
+// DATE_ANCHORS
+func ValidateDateAnchors(anchors []string) error {
+	for _, anchor := range anchors {
+		if !slices.Contains(DATE_ANCHORS, anchor) {
+			return fmt.Errorf("Unknown date anchor '%s', must be one of %v", anchor, DATE_ANCHORS)
+		}
+	}
+	return nil
+}
+
+// noteDate returns the date relative dates in the note are resolved against.
+// ANCHOR_TODAY isn't resolved here, todos anchored on the current date are
+// resolved when they are queried.
+func (p *noteParser) noteDate() (time.Time, bool) {
+	for _, anchor := range p.opts.DateAnchors {
+		switch anchor {
+		case ANCHOR_DAILY_NOTE:
+			name := strings.TrimSuffix(filepath.Base(p.note.Path), filepath.Ext(p.note.Path))
+			if date, err := time.Parse(p.opts.DailyNoteFormat, name); err == nil {
+				return dates.Day(date), true
+			}
+		case ANCHOR_CREATED:
+			if date, ok := frontMatterDate(p.source); ok {
+				return date, true
+			}
+		case ANCHOR_TODAY:
+			return time.Time{}, false
+		}
+	}
+	return time.Time{}, false
+}
+
+// frontMatterDate returns the created or date key of the yaml front matter
+func frontMatterDate(source []byte) (time.Time, bool) {
+	if !bytes.HasPrefix(source, []byte("---\n")) {
+		return time.Time{}, false
+	}
+	end := bytes.Index(source[4:], []byte("\n---"))
+	if end < 0 {
+		return time.Time{}, false
+	}
+
+	meta := map[string]interface{}{}
+	if err := yaml.Unmarshal(source[4:4+end], &meta); err != nil {
+		return time.Time{}, false
+	}
+	for _, key := range frontMatterDateKeys {
+		switch value := meta[key].(type) {
+		case time.Time:
+			return dates.Day(value), true
+		case string:
+			if len(value) >= len(dates.FORMAT) {
+				if date, err := time.Parse(dates.FORMAT, value[:len(dates.FORMAT)]); err == nil {
+					return date, true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
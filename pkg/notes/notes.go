@@ -0,0 +1,387 @@
+package notes
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/markdown"
+	"github.com/mrWinston/granite.nvim/pkg/models"
+	ts "github.com/smacker/go-tree-sitter"
+)
+
+// Options configure how todos are extracted from a note
+type Options struct {
+	// TodoTag marks a task list item as todo. Task list items nested inside
+	// a todo are its subtasks and don't need to carry the tag themselves.
+	TodoTag string
+	// States maps the markers of task list items to states. Items with a
+	// marker that isn't part of it are no todos. Defaults to
+	// models.DefaultStateConfig
+	States *models.StateConfig
+	// PriorityEmoji maps emoji to the priority they mark. Defaults to
+	// models.DefaultPriorityEmoji
+	PriorityEmoji map[string]models.Priority
+	// DateAnchors are tried in order to find the date relative dates in the
+	// note are resolved against. Defaults to DefaultDateAnchors
+	DateAnchors []string
+	// DailyNoteFormat is the go time layout of daily note file names.
+	// Defaults to DefaultDailyNoteFormat
+	DailyNoteFormat string
+}
+
+// markerRegex matches task markers the markdown grammar doesn't know about,
+// like [/] or [-], at the start of a list item paragraph
+var markerRegex = regexp.MustCompile(`^\[.?\]`)
+
+// skippedNodes are never searched for todos
+var skippedNodes = map[string]bool{
+	"fenced_code_block":   true,
+	"indented_code_block": true,
+	"html_block":          true,
+}
+
+type noteParser struct {
+	opts   Options
+	source []byte
+	lines  [][]byte
+	// lineStarts holds the byte offset of every line
+	lineStarts []int
+	note       *models.Note
+	// fingerprints counts todos with the same text to tell them apart
+	fingerprints map[string]int
+	// date relative dates are resolved against, if hasDate is set
+	date    time.Time
+	hasDate bool
+	// heading is the text of the last heading walked past
+	heading string
+}
+
+// Parse extracts all todos from the markdown in source, using the tree-sitter
+// markdown grammar. Todos are returned in the order they appear in the file.
+func Parse(path string, source []byte, opts Options) (*models.Note, error) {
+	if opts.States == nil {
+		opts.States = models.DefaultStateConfig
+	}
+	if opts.DateAnchors == nil {
+		opts.DateAnchors = DefaultDateAnchors
+	}
+	if opts.DailyNoteFormat == "" {
+		opts.DailyNoteFormat = DefaultDailyNoteFormat
+	}
+
+	tsparser := ts.NewParser()
+	tsparser.SetLanguage(markdown.GetLanguage())
+	tree, err := tsparser.ParseCtx(context.TODO(), nil, source)
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Close()
+
+	p := &noteParser{
+		opts:   opts,
+		source: source,
+		lines:  bytes.Split(source, []byte("\n")),
+		note: &models.Note{
+			Path:  path,
+			Todos: []*models.Todo{},
+		},
+		fingerprints: map[string]int{},
+	}
+	offset := 0
+	for _, line := range p.lines {
+		p.lineStarts = append(p.lineStarts, offset)
+		offset += len(line) + 1
+	}
+	p.date, p.hasDate = p.noteDate()
+	if p.hasDate {
+		p.note.Date = p.date.Format(models.DATE_FORMAT)
+	}
+	p.walk(tree.RootNode(), nil, nil)
+	models.RollUpEstimates(p.note.Todos)
+	return p.note, nil
+}
+
+// walk visits node and its children. parent is the innermost todo node is
+// nested in and list the innermost list.
+func (p *noteParser) walk(node *ts.Node, parent *models.Todo, list *ts.Node) {
+	if skippedNodes[node.Type()] {
+		return
+	}
+
+	switch node.Type() {
+	case "inline":
+		p.countMentions(node)
+	case "atx_heading", "setext_heading":
+		p.heading = p.headingText(node)
+	case "list":
+		list = node
+	case "list_item":
+		if todo := p.todoFromItem(node, parent, list); todo != nil {
+			for i := 0; i < int(node.NamedChildCount()); i++ {
+				p.walk(node.NamedChild(i), todo, list)
+			}
+			// notes and clocks leave out subtasks, so they are only known now
+			todo.Notes = p.notes(node, todo)
+			todo.SetClocks(p.clocks(todo))
+			return
+		}
+	}
+
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		p.walk(node.NamedChild(i), parent, list)
+	}
+}
+
+// headingText returns the text of a heading without its markers
+func (p *noteParser) headingText(node *ts.Node) string {
+	line := string(bytes.TrimSpace(p.lines[node.StartPoint().Row]))
+	if node.Type() == "setext_heading" {
+		return line
+	}
+	line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+	// closing sequences need a space in front, like in ## heading ##
+	if trimmed := strings.TrimRight(line, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+		line = strings.TrimSpace(trimmed)
+	}
+	return line
+}
+
+// countMentions adds the people mentioned in an inline node to the mentions
+// of the note
+func (p *noteParser) countMentions(node *ts.Node) {
+	for _, line := range strings.Split(node.Content(p.source), "\n") {
+		for _, name := range models.FindMentions(line) {
+			if p.note.Mentions == nil {
+				p.note.Mentions = map[string]int{}
+			}
+			p.note.Mentions[name]++
+		}
+	}
+}
+
+// todoFromItem returns the todo for a list item, or nil when the item isn't
+// a todo
+func (p *noteParser) todoFromItem(item *ts.Node, parent *models.Todo, list *ts.Node) *models.Todo {
+	markerRange, ok := p.taskMarker(item)
+	if !ok {
+		return nil
+	}
+
+	row := int(item.StartPoint().Row)
+	rawLine := string(p.lines[row])
+	if parent == nil && !strings.Contains(rawLine, p.opts.TodoTag) {
+		return nil
+	}
+
+	todo := &models.Todo{
+		RawLine:       rawLine,
+		LineNumber:    row + 1,
+		EndLineNumber: p.lastLine(item) + 1,
+		FilePath:      p.note.Path,
+		Parent:        parent,
+		List:          p.listRef(list),
+		Body:          strings.Join(p.itemLines(item, row, p.lastLine(item)), "\n"),
+		Range:         p.itemRange(item),
+		MarkerRange:   markerRange,
+		Heading:       p.heading,
+	}
+	if parent != nil {
+		todo.Depth = parent.Depth + 1
+	}
+
+	if err := todo.ParseWith(models.ParseOptions{
+		States:        p.opts.States,
+		PriorityEmoji: p.opts.PriorityEmoji,
+	}); err != nil {
+		return nil
+	}
+	if p.hasDate {
+		todo.ResolveDates(p.date)
+	}
+
+	if todo.ID == "" {
+		key := todo.Fingerprint(0)
+		todo.ID = todo.Fingerprint(p.fingerprints[key])
+		p.fingerprints[key]++
+	}
+
+	if parent != nil {
+		parent.AddChild(todo)
+	}
+	p.note.Todos = append(p.note.Todos, todo)
+	return todo
+}
+
+// taskMarker returns the range of the task marker the list item starts with.
+// ok is false when the item isn't a task.
+func (p *noteParser) taskMarker(item *ts.Node) (models.Range, bool) {
+	for i := 0; i < int(item.NamedChildCount()); i++ {
+		child := item.NamedChild(i)
+		switch child.Type() {
+		case "task_list_marker_checked", "task_list_marker_unchecked":
+			return p.rangeOf(int(child.StartByte()), int(child.EndByte())), true
+		case "paragraph":
+			loc := markerRegex.FindIndex(p.source[child.StartByte():child.EndByte()])
+			if loc == nil {
+				return models.Range{}, false
+			}
+			start := int(child.StartByte())
+			return p.rangeOf(start+loc[0], start+loc[1]), true
+		}
+	}
+	return models.Range{}, false
+}
+
+// itemRange returns the range of a list item without trailing blank lines
+func (p *noteParser) itemRange(item *ts.Node) models.Range {
+	last := p.lastLine(item)
+	end := p.lineStarts[last] + len(bytes.TrimRight(p.lines[last], "\r"))
+	return p.rangeOf(int(item.StartByte()), end)
+}
+
+// rangeOf converts a span of bytes into a range
+func (p *noteParser) rangeOf(startByte int, endByte int) models.Range {
+	startLine, startCol := p.position(startByte)
+	endLine, endCol := p.position(endByte)
+	return models.Range{
+		StartByte: startByte,
+		EndByte:   endByte,
+		StartLine: startLine + 1,
+		StartCol:  startCol,
+		EndLine:   endLine + 1,
+		EndCol:    endCol,
+	}
+}
+
+// position returns the row and column of a byte offset
+func (p *noteParser) position(offset int) (int, int) {
+	row := sort.Search(len(p.lineStarts), func(i int) bool {
+		return p.lineStarts[i] > offset
+	}) - 1
+	if row < 0 {
+		row = 0
+	}
+	return row, offset - p.lineStarts[row]
+}
+
+// contentColumn returns the column where the content of a list item starts,
+// right after the list marker
+func contentColumn(item *ts.Node) int {
+	marker := item.NamedChild(0)
+	if marker == nil || !strings.HasPrefix(marker.Type(), "list_marker") {
+		return int(item.StartPoint().Column)
+	}
+	return int(marker.EndPoint().Column)
+}
+
+// itemLines returns the rows from start to end of a list item with the
+// indentation of the item content removed. The first line of the item also
+// loses its list marker.
+func (p *noteParser) itemLines(item *ts.Node, start int, end int) []string {
+	col := contentColumn(item)
+	out := []string{}
+	for row := start; row <= end && row < len(p.lines); row++ {
+		line := p.lines[row]
+		if row == int(item.StartPoint().Row) {
+			line = line[min(col, len(line)):]
+		} else {
+			line = trimIndent(line, col)
+		}
+		out = append(out, string(bytes.TrimRight(line, "\r")))
+	}
+	return out
+}
+
+// trimIndent removes up to n leading whitespace characters from line
+func trimIndent(line []byte, n int) []byte {
+	i := 0
+	for i < n && i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return line[i:]
+}
+
+// notes returns everything in item below its first paragraph, leaving out
+// the lines of subtasks
+func (p *noteParser) notes(item *ts.Node, todo *models.Todo) string {
+	start := int(item.StartPoint().Row) + 1
+	for i := 0; i < int(item.NamedChildCount()); i++ {
+		if child := item.NamedChild(i); child.Type() == "paragraph" {
+			start = p.lastLine(child) + 1
+			break
+		}
+	}
+	end := todo.EndLineNumber - 1
+
+	lines := []string{}
+	for row := start; row <= end; row++ {
+		if isSubtaskLine(todo, row+1) || models.IsClockLine(string(p.lines[row])) {
+			continue
+		}
+		lines = append(lines, p.itemLines(item, row, row)...)
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// clocks returns the clock entries in the lines of todo, without the ones
+// of its subtasks
+func (p *noteParser) clocks(todo *models.Todo) []*models.Clock {
+	clocks := []*models.Clock{}
+	for row := todo.LineNumber; row < todo.EndLineNumber && row < len(p.lines); row++ {
+		if isSubtaskLine(todo, row+1) {
+			continue
+		}
+		if clock, ok := models.ParseClock(string(p.lines[row])); ok {
+			clock.LineNumber = row + 1
+			clocks = append(clocks, clock)
+		}
+	}
+	return clocks
+}
+
+func isSubtaskLine(todo *models.Todo, lineNumber int) bool {
+	for _, child := range todo.Children {
+		if lineNumber >= child.LineNumber && lineNumber <= child.EndLineNumber {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *noteParser) listRef(list *ts.Node) *models.ListRef {
+	if list == nil {
+		return nil
+	}
+	ordered := false
+	if item := list.NamedChild(0); item != nil && item.NamedChild(0) != nil {
+		marker := item.NamedChild(0).Type()
+		ordered = marker == "list_marker_dot" || marker == "list_marker_parenthesis"
+	}
+	return &models.ListRef{
+		LineNumber:    int(list.StartPoint().Row) + 1,
+		EndLineNumber: p.lastLine(list) + 1,
+		Ordered:       ordered,
+	}
+}
+
+// lastLine returns the last row of node that has content. Block nodes of the
+// markdown grammar include the trailing newline, blank lines and the
+// indentation of the following block.
+func (p *noteParser) lastLine(node *ts.Node) int {
+	start := int(node.StartPoint().Row)
+	end := int(node.EndPoint().Row)
+	if end > start && end < len(p.lines) {
+		col := min(int(node.EndPoint().Column), len(p.lines[end]))
+		if len(bytes.TrimSpace(p.lines[end][:col])) == 0 {
+			end--
+		}
+	}
+	for end > start && end < len(p.lines) && len(bytes.TrimSpace(p.lines[end])) == 0 {
+		end--
+	}
+	return end
+}
@@ -0,0 +1,316 @@
+package notes
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testNote = `# Sprint
+
+- [ ] #task top level
+  - [/] subtask #backend
+    - [x] nested subtask
+  - plain bullet
+    - [ ] subtask below a plain bullet
+- [ ] not a todo
+1. [x] done #task
+
+` + "```" + `
+- [ ] #task inside a code block
+` + "```" + `
+- [ ] #task last line`
+
+func TestParse(t *testing.T) {
+	note, err := Parse("note.md", []byte(testNote), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var lines []int
+	for _, todo := range note.Todos {
+		lines = append(lines, todo.LineNumber)
+	}
+	if want := []int{3, 4, 5, 7, 9, 14}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("todos found on lines %v, want %v", lines, want)
+	}
+
+	top, sub, nested, belowBullet, ordered := note.Todos[0], note.Todos[1], note.Todos[2], note.Todos[3], note.Todos[4]
+
+	if top.Depth != 0 || sub.Depth != 1 || nested.Depth != 2 || belowBullet.Depth != 1 {
+		t.Errorf("unexpected depths: %d %d %d %d", top.Depth, sub.Depth, nested.Depth, belowBullet.Depth)
+	}
+	if sub.Parent != top || nested.Parent != sub || belowBullet.Parent != top {
+		t.Errorf("subtasks not linked to their parents")
+	}
+	if !reflect.DeepEqual(top.ChildLineNumbers, []int{4, 7}) {
+		t.Errorf("top.ChildLineNumbers = %v, want [4 7]", top.ChildLineNumbers)
+	}
+	if nested.ParentLineNumber != 4 {
+		t.Errorf("nested.ParentLineNumber = %d, want 4", nested.ParentLineNumber)
+	}
+	if len(nested.Tags) != 0 || !reflect.DeepEqual(sub.Tags, []string{"#backend"}) {
+		t.Errorf("nested.Tags = %v, sub.Tags = %v, want only the tags of their own lines", nested.Tags, sub.Tags)
+	}
+	if nested.ParentID != sub.ID {
+		t.Errorf("nested.ParentID = %s, want %s", nested.ParentID, sub.ID)
+	}
+	if sub.StateString != "IN_PROGRESS" || nested.StateString != "DONE" {
+		t.Errorf("unexpected states %s, %s", sub.StateString, nested.StateString)
+	}
+
+	if top.List.LineNumber != 3 || top.List.EndLineNumber != 8 || top.List.Ordered {
+		t.Errorf("unexpected list of top level todo: %+v", top.List)
+	}
+	if !ordered.List.Ordered {
+		t.Errorf("expected todo in numbered list to have an ordered list")
+	}
+}
+
+const testMultilineNote = `- [ ] #task deploy the service
+  to production
+  - check the dashboards
+  - [ ] #task write announcement
+
+  ` + "```sh" + `
+  make deploy
+  ` + "```" + `
+
+next paragraph
+`
+
+func TestParseBody(t *testing.T) {
+	note, err := Parse("note.md", []byte(testMultilineNote), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(note.Todos) != 2 {
+		t.Fatalf("expected 2 todos, got %d", len(note.Todos))
+	}
+
+	todo := note.Todos[0]
+	if todo.LineNumber != 1 || todo.EndLineNumber != 8 {
+		t.Errorf("todo spans lines %d-%d, want 1-8", todo.LineNumber, todo.EndLineNumber)
+	}
+
+	wantBody := "[ ] #task deploy the service\nto production\n- check the dashboards\n- [ ] #task write announcement\n\n```sh\nmake deploy\n```"
+	if todo.Body != wantBody {
+		t.Errorf("Body = %q, want %q", todo.Body, wantBody)
+	}
+
+	wantNotes := "- check the dashboards\n\n```sh\nmake deploy\n```"
+	if todo.Notes != wantNotes {
+		t.Errorf("Notes = %q, want %q", todo.Notes, wantNotes)
+	}
+
+	sub := note.Todos[1]
+	if sub.Body != "[ ] #task write announcement" || sub.Notes != "" {
+		t.Errorf("unexpected subtask body %q and notes %q", sub.Body, sub.Notes)
+	}
+}
+
+func TestParseIdentity(t *testing.T) {
+	before, err := Parse("note.md", []byte("- [ ] #task same\n- [ ] #task same\n- [ ] #task anchored ^t-abc123\n"), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	after, err := Parse("note.md", []byte("# new heading\n\n- [x] #task same\n- [ ] #task same\n- [ ] #task anchored ^t-abc123\n"), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	for i := range before.Todos {
+		if before.Todos[i].ID != after.Todos[i].ID {
+			t.Errorf("ID of todo %d changed from %s to %s", i, before.Todos[i].ID, after.Todos[i].ID)
+		}
+	}
+	if before.Todos[0].ID == before.Todos[1].ID {
+		t.Errorf("todos with the same text share the ID %s", before.Todos[0].ID)
+	}
+
+	anchored := after.Todos[2]
+	if anchored.ID != "t-abc123" || anchored.Anchor != "t-abc123" {
+		t.Errorf("anchored todo has ID %q and anchor %q", anchored.ID, anchored.Anchor)
+	}
+	if anchored.Text != "[ ] #task anchored" {
+		t.Errorf("anchor not removed from text: %q", anchored.Text)
+	}
+
+	marker := after.Todos[0].MarkerRange
+	if marker.StartLine != 3 || marker.StartCol != 2 || marker.EndCol != 5 || marker.StartByte != 17 {
+		t.Errorf("unexpected marker range %+v", marker)
+	}
+	item := after.Todos[1].Range
+	if item.StartLine != 4 || item.EndLine != 4 || item.StartCol != 0 || item.EndCol != 16 {
+		t.Errorf("unexpected item range %+v", item)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	source := "- [ ] #task ship 2024-01-01 due:2024-05-01 estimate:1h30m [priority:: high] points:3 see https://example.com every:month on 1st #later\n" +
+		"- [ ] #task no due date 2024-01-01\n"
+
+	note, err := Parse("note.md", []byte(source), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	fields := note.Todos[0].Fields
+	if due := fields["due"]; due == nil || due.Type != "date" || due.Date != "2024-05-01" {
+		t.Errorf("unexpected due field %+v", due)
+	}
+	if estimate := fields["estimate"]; estimate == nil || estimate.Type != "duration" || estimate.Seconds != 5400 {
+		t.Errorf("unexpected estimate field %+v", estimate)
+	}
+	if priority := fields["priority"]; priority == nil || priority.Type != "string" || priority.Raw != "high" {
+		t.Errorf("unexpected priority field %+v", priority)
+	}
+	if points := fields["points"]; points == nil || points.Type != "number" || points.Number != 3 {
+		t.Errorf("unexpected points field %+v", points)
+	}
+	if every := fields["every"]; every == nil || every.Raw != "month on 1st" || note.Todos[0].Recurrence == nil {
+		t.Errorf("unexpected every field %+v", every)
+	}
+	if _, ok := fields["https"]; ok {
+		t.Errorf("url parsed as a field")
+	}
+	if raw := note.Todos[0].RawLine; raw[fields["due"].Col:fields["due"].EndCol] != "due:2024-05-01" {
+		t.Errorf("due field spans %q", raw[fields["due"].Col:fields["due"].EndCol])
+	}
+
+	if note.Todos[0].DueDate != "2024-05-01" {
+		t.Errorf("DueDate = %q, want 2024-05-01", note.Todos[0].DueDate)
+	}
+	if note.Todos[1].DueDate != "" {
+		t.Errorf("bare date taken as due date: %q", note.Todos[1].DueDate)
+	}
+}
+
+func TestParseRelativeDates(t *testing.T) {
+	source := "- [ ] #task review due:tomorrow scheduled:fri\n- [ ] #task absolute due:2024-06-01\n"
+
+	daily, err := Parse("journal/2024-05-15.md", []byte(source), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if daily.Date != "2024-05-15" {
+		t.Errorf("daily note date = %q", daily.Date)
+	}
+	if daily.Todos[0].DueDate != "2024-05-16" || daily.Todos[0].Fields["scheduled"].Date != "2024-05-17" {
+		t.Errorf("relative dates resolved to %q and %q", daily.Todos[0].DueDate, daily.Todos[0].Fields["scheduled"].Date)
+	}
+	if daily.Todos[1].DueDate != "2024-06-01" {
+		t.Errorf("absolute due date changed to %q", daily.Todos[1].DueDate)
+	}
+
+	created, err := Parse("project.md", []byte("---\ncreated: 2024-02-28\n---\n"+source), Options{
+		TodoTag:     "#task",
+		DateAnchors: []string{ANCHOR_CREATED},
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if created.Todos[0].DueDate != "2024-02-29" {
+		t.Errorf("due date relative to front matter = %q", created.Todos[0].DueDate)
+	}
+
+	unanchored, err := Parse("project.md", []byte(source), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if todo := unanchored.Todos[0]; todo.DueDate != "" || !todo.HasUnresolvedDates() {
+		t.Errorf("due date resolved without an anchor: %q", todo.DueDate)
+	}
+}
+
+func TestParseStamps(t *testing.T) {
+	open, err := Parse("note.md", []byte("- [ ] #task ship created:2024-05-01\n"), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	done, err := Parse("note.md", []byte("- [x] #task ship created:2024-05-01 done:2024-05-03\n"), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if open.Todos[0].ID != done.Todos[0].ID {
+		t.Errorf("done: stamp changed the ID from %s to %s", open.Todos[0].ID, done.Todos[0].ID)
+	}
+	if todo := done.Todos[0]; todo.CreatedDate != "2024-05-01" || todo.CompletedDate != "2024-05-03" {
+		t.Errorf("created %q and completed %q", todo.CreatedDate, todo.CompletedDate)
+	}
+	if open.Todos[0].CompletedDate != "" {
+		t.Errorf("open todo has a completion date %q", open.Todos[0].CompletedDate)
+	}
+}
+
+func TestParseClocks(t *testing.T) {
+	source := "- [ ] #task bill client\n" +
+		"  CLOCK: [2024-05-02 Thu 14:00]\n" +
+		"  CLOCK: [2024-05-01 Wed 09:00]--[2024-05-01 Wed 10:30] =>  1:30\n" +
+		"  - [ ] subtask\n" +
+		"    CLOCK: [2024-05-01 Wed 11:00]--[2024-05-01 Wed 11:15] =>  0:15\n"
+
+	note, err := Parse("note.md", []byte(source), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	todo := note.Todos[0]
+	if len(todo.Clocks) != 2 || todo.TrackedSeconds != 5400 {
+		t.Errorf("todo has %d clocks tracking %d seconds", len(todo.Clocks), todo.TrackedSeconds)
+	}
+	if clock, ok := todo.RunningClock(); !ok || clock.LineNumber != 2 {
+		t.Errorf("running clock %+v", clock)
+	}
+	if sub := note.Todos[1]; sub.TrackedSeconds != 900 || sub.Text != "[ ] subtask" {
+		t.Errorf("subtask %q tracked %d seconds", sub.Text, sub.TrackedSeconds)
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	source := "# Meeting with @alice\n\n" +
+		"Talked to @bob and @alice, mail bob@example.org\n\n" +
+		"- [ ] #task send the minutes @bob\n" +
+		"  - [ ] subtask\n" +
+		"  - [ ] subtask for @carol\n\n" +
+		"```\n@dave\n```\n"
+
+	note, err := Parse("note.md", []byte(source), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := map[string]int{"alice": 2, "bob": 2, "carol": 1}
+	if !reflect.DeepEqual(note.Mentions, want) {
+		t.Errorf("Mentions = %v, want %v", note.Mentions, want)
+	}
+	for i, assignees := range [][]string{{"bob"}, {}, {"carol"}} {
+		if got := note.Todos[i].Assignees; !reflect.DeepEqual(got, assignees) {
+			t.Errorf("todo %d: Assignees = %v, want %v", i, got, assignees)
+		}
+	}
+}
+
+func TestParseHeadings(t *testing.T) {
+	source := "- [ ] #task above\n" +
+		"# Sprint 12 ##\n\n" +
+		"- [ ] #task epic ~1w\n" +
+		"  - [x] subtask ~3h\n\n" +
+		"Backlog\n" +
+		"-------\n\n" +
+		"- [ ] #task later\n"
+
+	note, err := Parse("note.md", []byte(source), Options{TodoTag: "#task"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	for i, heading := range []string{"", "Sprint 12", "Sprint 12", "Backlog"} {
+		if got := note.Todos[i].Heading; got != heading {
+			t.Errorf("todo %d: Heading = %q, want %q", i, got, heading)
+		}
+	}
+	if effort := note.Todos[1].Effort; effort.RemainingSeconds != 37*3600 || effort.CompletedSeconds != 3*3600 {
+		t.Errorf("Effort = %+v", effort)
+	}
+}
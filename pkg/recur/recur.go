@@ -0,0 +1,344 @@
+// Package recur parses recurrence rules like "week", "2 days",
+// "month on 1st" or the RRULE subset FREQ=WEEKLY;INTERVAL=2;BYDAY=MO and
+// computes the next occurrence of a date
+package recur
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DAILY   = "daily"
+	WEEKLY  = "weekly"
+	MONTHLY = "monthly"
+	YEARLY  = "yearly"
+)
+
+// DATE_FORMAT is the format of Until
+const DATE_FORMAT = "2006-01-02"
+
+// LAST_DAY as MonthDay repeats on the last day of the month
+const LAST_DAY = -1
+
+// Rule describes when something repeats
+type Rule struct {
+	// Raw is the rule as written in the note
+	Raw string `json:"raw"`
+	// Freq is one of DAILY, WEEKLY, MONTHLY or YEARLY
+	Freq string `json:"freq"`
+	// Interval is the number of periods between two occurrences
+	Interval int `json:"interval"`
+	// Weekdays limit weekly rules to these days
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+	// MonthDay is the day of monthly rules, LAST_DAY for the last day of the month
+	MonthDay int `json:"month_day,omitempty"`
+	// Until is the last date an occurrence can fall on, formatted as YYYY-MM-DD
+	Until string `json:"until,omitempty"`
+}
+
+var units = map[string]string{
+	"day": DAILY, "days": DAILY, "daily": DAILY,
+	"week": WEEKLY, "weeks": WEEKLY, "weekly": WEEKLY,
+	"month": MONTHLY, "months": MONTHLY, "monthly": MONTHLY,
+	"year": YEARLY, "years": YEARLY, "yearly": YEARLY,
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday, "su": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday, "mo": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday, "tu": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday, "we": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday, "th": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday, "fr": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday, "sa": time.Saturday,
+}
+
+var workdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// ordinalRegex matches days of the month like 1st, 2nd, 23rd or 15
+var ordinalRegex = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?$`)
+
+// Parse parses a recurrence rule. It understands
+//
+//	day, week, month, year, daily, weekly, monthly, yearly
+//	2 days, 3 weeks, ...
+//	weekday, monday, mon,thu
+//	week on mon, 2 weeks on mon,fri
+//	month on 1st, month on the 15th, month on last
+//	FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;BYMONTHDAY=1;UNTIL=20241231
+func Parse(raw string) (*Rule, error) {
+	expr := strings.ToLower(strings.TrimSpace(raw))
+	var rule *Rule
+	var err error
+	if strings.HasPrefix(expr, "rrule:") || strings.HasPrefix(expr, "freq=") {
+		rule, err = parseRRule(strings.TrimPrefix(expr, "rrule:"))
+	} else {
+		rule, err = parseNatural(expr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rule.Raw = raw
+	return rule, nil
+}
+
+func parseNatural(expr string) (*Rule, error) {
+	words := strings.Fields(strings.ReplaceAll(expr, ",", " , "))
+	if len(words) == 0 {
+		return nil, fmt.Errorf("Empty recurrence")
+	}
+	rule := &Rule{Interval: 1}
+
+	if words[0] == "weekday" || words[0] == "weekdays" {
+		if len(words) > 1 {
+			return nil, fmt.Errorf("Unexpected '%s' in recurrence '%s'", words[1], expr)
+		}
+		rule.Freq = WEEKLY
+		rule.Weekdays = workdays
+		return rule, nil
+	}
+	if _, ok := weekdayNames[words[0]]; ok {
+		rule.Freq = WEEKLY
+		days, err := parseWeekdays(words)
+		if err != nil {
+			return nil, err
+		}
+		rule.Weekdays = days
+		return rule, nil
+	}
+
+	if n, err := strconv.Atoi(words[0]); err == nil {
+		if n < 1 {
+			return nil, fmt.Errorf("Interval of recurrence '%s' must be positive", expr)
+		}
+		rule.Interval = n
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("Missing unit in recurrence '%s'", expr)
+	}
+	freq, ok := units[words[0]]
+	if !ok {
+		return nil, fmt.Errorf("Unknown unit '%s' in recurrence '%s'", words[0], expr)
+	}
+	rule.Freq = freq
+	words = words[1:]
+
+	if len(words) == 0 {
+		return rule, nil
+	}
+	if words[0] != "on" || len(words) == 1 {
+		return nil, fmt.Errorf("Unexpected '%s' in recurrence '%s'", words[0], expr)
+	}
+	words = words[1:]
+	if words[0] == "the" {
+		words = words[1:]
+	}
+
+	switch freq {
+	case WEEKLY:
+		days, err := parseWeekdays(words)
+		if err != nil {
+			return nil, err
+		}
+		rule.Weekdays = days
+	case MONTHLY:
+		if len(words) != 1 {
+			return nil, fmt.Errorf("Expected a single day of the month in recurrence '%s'", expr)
+		}
+		day, err := parseMonthDay(words[0])
+		if err != nil {
+			return nil, err
+		}
+		rule.MonthDay = day
+	default:
+		return nil, fmt.Errorf("'on' is only supported for weekly and monthly recurrences: '%s'", expr)
+	}
+	return rule, nil
+}
+
+// parseWeekdays parses a list of weekday names, separated by commas or spaces
+func parseWeekdays(words []string) ([]time.Weekday, error) {
+	seen := map[time.Weekday]bool{}
+	days := []time.Weekday{}
+	for _, word := range words {
+		for _, name := range strings.Split(word, ",") {
+			if name == "" || name == "and" {
+				continue
+			}
+			day, ok := weekdayNames[name]
+			if !ok {
+				return nil, fmt.Errorf("Unknown weekday '%s'", name)
+			}
+			if !seen[day] {
+				seen[day] = true
+				days = append(days, day)
+			}
+		}
+	}
+	if len(days) == 0 {
+		return nil, fmt.Errorf("Missing weekday")
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+	return days, nil
+}
+
+func parseMonthDay(word string) (int, error) {
+	if word == "last" || word == "-1" {
+		return LAST_DAY, nil
+	}
+	m := ordinalRegex.FindStringSubmatch(word)
+	if m == nil {
+		return 0, fmt.Errorf("Invalid day of the month '%s'", word)
+	}
+	day, _ := strconv.Atoi(m[1])
+	if day < 1 || day > 31 {
+		return 0, fmt.Errorf("Invalid day of the month '%s'", word)
+	}
+	return day, nil
+}
+
+func parseRRule(expr string) (*Rule, error) {
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(expr, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid rrule part '%s'", part)
+		}
+		switch key {
+		case "freq":
+			switch value {
+			case "daily", "weekly", "monthly", "yearly":
+				rule.Freq = value
+			default:
+				return nil, fmt.Errorf("Unsupported rrule frequency '%s'", value)
+			}
+		case "interval":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("Invalid rrule interval '%s'", value)
+			}
+			rule.Interval = n
+		case "byday":
+			days, err := parseWeekdays([]string{value})
+			if err != nil {
+				return nil, err
+			}
+			rule.Weekdays = days
+		case "bymonthday":
+			day, err := parseMonthDay(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.MonthDay = day
+		case "until":
+			until, err := time.Parse("20060102", value[:min(len(value), 8)])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid rrule until '%s'", value)
+			}
+			rule.Until = until.Format(DATE_FORMAT)
+		default:
+			return nil, fmt.Errorf("Unsupported rrule part '%s'", strings.ToUpper(key))
+		}
+	}
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("Rrule '%s' has no FREQ", expr)
+	}
+	if len(rule.Weekdays) > 0 && rule.Freq != WEEKLY {
+		return nil, fmt.Errorf("BYDAY is only supported for weekly rrules")
+	}
+	if rule.MonthDay != 0 && rule.Freq != MONTHLY {
+		return nil, fmt.Errorf("BYMONTHDAY is only supported for monthly rrules")
+	}
+	return rule, nil
+}
+
+// Next returns the first occurrence after the day of after. ok is false when
+// the rule ends before that.
+func (r *Rule) Next(after time.Time) (next time.Time, ok bool) {
+	after = time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, time.UTC)
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	switch r.Freq {
+	case DAILY:
+		next = after.AddDate(0, 0, interval)
+	case WEEKLY:
+		next = r.nextWeekly(after, interval)
+	case MONTHLY:
+		next = r.nextMonthly(after, interval)
+	case YEARLY:
+		next = addMonths(after, 12*interval, after.Day())
+	default:
+		return time.Time{}, false
+	}
+
+	if r.Until != "" {
+		if until, err := time.Parse(DATE_FORMAT, r.Until); err == nil && next.After(until) {
+			return time.Time{}, false
+		}
+	}
+	return next, true
+}
+
+func (r *Rule) nextWeekly(after time.Time, interval int) time.Time {
+	if len(r.Weekdays) == 0 {
+		return after.AddDate(0, 0, 7*interval)
+	}
+	days := map[time.Weekday]bool{}
+	for _, day := range r.Weekdays {
+		days[day] = true
+	}
+	weekStart := startOfWeek(after)
+	for d := after.AddDate(0, 0, 1); ; d = d.AddDate(0, 0, 1) {
+		weeks := int(startOfWeek(d).Sub(weekStart).Hours()) / (24 * 7)
+		if days[d.Weekday()] && weeks%interval == 0 {
+			return d
+		}
+	}
+}
+
+func (r *Rule) nextMonthly(after time.Time, interval int) time.Time {
+	if r.MonthDay == 0 {
+		return addMonths(after, interval, after.Day())
+	}
+	for months := 0; ; months += interval {
+		candidate := addMonths(after, months, r.MonthDay)
+		if candidate.After(after) {
+			return candidate
+		}
+	}
+}
+
+// addMonths returns day in the month months after t. Days past the end of
+// the month and LAST_DAY are clamped to its last day.
+func addMonths(t time.Time, months int, day int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	if day == LAST_DAY || day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// startOfWeek returns the monday of the week of t
+func startOfWeek(t time.Time) time.Time {
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,64 @@
+package recur
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// a wednesday
+	from := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]string{
+		"day":                         "2024-02-01",
+		"2 days":                      "2024-02-02",
+		"week":                        "2024-02-07",
+		"weekly":                      "2024-02-07",
+		"weekday":                     "2024-02-01",
+		"fri":                         "2024-02-02",
+		"mon, thu":                    "2024-02-01",
+		"2 weeks on mon":              "2024-02-12",
+		"week on wed":                 "2024-02-07",
+		"month":                       "2024-02-29",
+		"month on 1st":                "2024-02-01",
+		"month on the 15th":           "2024-02-15",
+		"3 months on last":            "2024-04-30",
+		"year":                        "2025-01-31",
+		"FREQ=WEEKLY;BYDAY=MO,FR":     "2024-02-02",
+		"RRULE:FREQ=DAILY;INTERVAL=3": "2024-02-03",
+		"FREQ=MONTHLY;BYMONTHDAY=-1":  "2024-02-29",
+	}
+	for expr, want := range tests {
+		rule, err := Parse(expr)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", expr, err)
+			continue
+		}
+		next, ok := rule.Next(from)
+		if !ok {
+			t.Errorf("%q has no occurrence after %s", expr, from.Format(DATE_FORMAT))
+			continue
+		}
+		if got := next.Format(DATE_FORMAT); got != want {
+			t.Errorf("next occurrence of %q = %s, want %s", expr, got, want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{"", "2", "fortnight", "day on mon", "week on", "FREQ=HOURLY", "FREQ=DAILY;COUNT=3"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid rule", expr)
+		}
+	}
+}
+
+func TestUntil(t *testing.T) {
+	rule, err := Parse("FREQ=WEEKLY;UNTIL=20240205")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := rule.Next(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("rule continues after UNTIL")
+	}
+}
@@ -0,0 +1,74 @@
+package tagquery
+
+import "math/bits"
+
+// Bitset is a set of todo IDs, the positions of the todos in an Index
+type Bitset struct {
+	words []uint64
+	size  int
+}
+
+// NewBitset returns an empty set for IDs below size
+func NewBitset(size int) *Bitset {
+	return &Bitset{words: make([]uint64, (size+63)/64), size: size}
+}
+
+// Add adds id to the set
+func (b *Bitset) Add(id int) {
+	b.words[id/64] |= 1 << (id % 64)
+}
+
+// Has reports whether id is part of the set
+func (b *Bitset) Has(id int) bool {
+	return b.words[id/64]&(1<<(id%64)) != 0
+}
+
+// And returns the intersection of b and other
+func (b *Bitset) And(other *Bitset) *Bitset {
+	out := NewBitset(b.size)
+	for i := range out.words {
+		out.words[i] = b.words[i] & other.words[i]
+	}
+	return out
+}
+
+// Or returns the union of b and other
+func (b *Bitset) Or(other *Bitset) *Bitset {
+	out := NewBitset(b.size)
+	for i := range out.words {
+		out.words[i] = b.words[i] | other.words[i]
+	}
+	return out
+}
+
+// Not returns the complement of b
+func (b *Bitset) Not() *Bitset {
+	out := NewBitset(b.size)
+	for i := range out.words {
+		out.words[i] = ^b.words[i]
+	}
+	// IDs beyond size aren't part of any set
+	if rest := b.size % 64; rest != 0 {
+		out.words[len(out.words)-1] &= 1<<rest - 1
+	}
+	return out
+}
+
+// Count returns the number of IDs in the set
+func (b *Bitset) Count() int {
+	n := 0
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Each calls fn with every ID of the set in ascending order
+func (b *Bitset) Each(fn func(id int)) {
+	for i, w := range b.words {
+		for w != 0 {
+			fn(i*64 + bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+}
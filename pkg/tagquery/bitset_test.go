@@ -0,0 +1,50 @@
+package tagquery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func bitsetOf(size int, ids ...int) *Bitset {
+	b := NewBitset(size)
+	for _, id := range ids {
+		b.Add(id)
+	}
+	return b
+}
+
+func members(b *Bitset) []int {
+	out := []int{}
+	b.Each(func(id int) {
+		out = append(out, id)
+	})
+	return out
+}
+
+func TestBitset(t *testing.T) {
+	lhs := bitsetOf(130, 0, 3, 64, 129)
+	rhs := bitsetOf(130, 3, 65, 129)
+
+	tests := []struct {
+		name string
+		got  *Bitset
+		want []int
+	}{
+		{"and", lhs.And(rhs), []int{3, 129}},
+		{"or", lhs.Or(rhs), []int{0, 3, 64, 65, 129}},
+		{"not", bitsetOf(5, 0, 2).Not(), []int{1, 3, 4}},
+		{"not across words", bitsetOf(66, 0, 63).Not().And(bitsetOf(66, 0, 1, 63, 64, 65)), []int{1, 64, 65}},
+		{"not of empty", NewBitset(0).Not(), []int{}},
+	}
+	for _, tt := range tests {
+		if got := members(tt.got); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.got.Count() != len(tt.want) {
+			t.Errorf("%s: Count() = %d, want %d", tt.name, tt.got.Count(), len(tt.want))
+		}
+	}
+	if !lhs.Has(64) || lhs.Has(65) {
+		t.Errorf("Has() doesn't match the members %v", members(lhs))
+	}
+}
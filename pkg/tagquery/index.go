@@ -0,0 +1,147 @@
+package tagquery
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+)
+
+// Index maps tags and assignees to the todos carrying them. Todos are
+// identified by their position, so query results keep the order the todos
+// were indexed in.
+type Index struct {
+	todos []*models.Todo
+	// tags maps tags as written to the IDs of their todos
+	tags map[string]*Bitset
+	// assignees maps lower cased names to the IDs of their todos
+	assignees map[string]*Bitset
+	// all holds every ID
+	all *Bitset
+}
+
+// NewIndex indexes todos. A todo that appears more than once is indexed
+// once, at its first position.
+func NewIndex(todos []*models.Todo) *Index {
+	idx := &Index{
+		tags:      map[string]*Bitset{},
+		assignees: map[string]*Bitset{},
+	}
+	seen := map[*models.Todo]bool{}
+	for _, todo := range todos {
+		if !seen[todo] {
+			seen[todo] = true
+			idx.todos = append(idx.todos, todo)
+		}
+	}
+
+	idx.all = NewBitset(len(idx.todos))
+	for id, todo := range idx.todos {
+		idx.all.Add(id)
+		for _, tag := range todo.Tags {
+			idx.add(idx.tags, tag, id)
+		}
+		for _, name := range todo.Assignees {
+			idx.add(idx.assignees, strings.ToLower(name), id)
+		}
+	}
+	return idx
+}
+
+func (idx *Index) add(sets map[string]*Bitset, key string, id int) {
+	set, ok := sets[key]
+	if !ok {
+		set = NewBitset(len(idx.todos))
+		sets[key] = set
+	}
+	set.Add(id)
+}
+
+// Indexes reports whether idx was built from exactly todos
+func (idx *Index) Indexes(todos []*models.Todo) bool {
+	return slices.Equal(idx.todos, todos)
+}
+
+// With returns an index of todos that shares the tags and assignees of idx.
+// todos are copies of the indexed todos in index order, with values the
+// predicates look at filled in. Anything else is indexed anew.
+func (idx *Index) With(todos []*models.Todo) *Index {
+	if len(todos) != len(idx.todos) {
+		return NewIndex(todos)
+	}
+	with := *idx
+	with.todos = todos
+	return &with
+}
+
+// Todos returns the todos of set in index order
+func (idx *Index) Todos(set *Bitset) []*models.Todo {
+	out := make([]*models.Todo, 0, set.Count())
+	set.Each(func(id int) {
+		out = append(out, idx.todos[id])
+	})
+	return out
+}
+
+// Execute returns the todos of idx matching the tree, with terms compiled
+// by ParseTerm against env. Tags and assignees are looked up in the index,
+// every other term scans the todos once, however often it appears.
+func (t *TagQueryToken) Execute(idx *Index, env Env) ([]*models.Todo, error) {
+	sets := map[string]*Bitset{}
+	var err error
+	t.walkTerms(func(term string) {
+		if _, ok := sets[term]; ok || err != nil {
+			return
+		}
+		sets[term], err = idx.termSet(term, env)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx.Todos(t.eval(idx, sets)), nil
+}
+
+func (t *TagQueryToken) eval(idx *Index, sets map[string]*Bitset) *Bitset {
+	if t.IsTerm() {
+		return sets[t.Content]
+	}
+	switch t.Content {
+	case "AND":
+		return t.Lhs.eval(idx, sets).And(t.Rhs.eval(idx, sets))
+	case "OR":
+		return t.Lhs.eval(idx, sets).Or(t.Rhs.eval(idx, sets))
+	case "NOT":
+		return t.Lhs.eval(idx, sets).Not()
+	}
+	return NewBitset(len(idx.todos))
+}
+
+// termSet returns the IDs of the todos matching term
+func (idx *Index) termSet(term string, env Env) (*Bitset, error) {
+	compiled, err := compileTerm(term, env)
+	if err != nil {
+		return nil, err
+	}
+
+	set := NewBitset(len(idx.todos))
+	switch {
+	case compiled.assignee != "":
+		if ids, ok := idx.assignees[compiled.assignee]; ok {
+			set = set.Or(ids)
+		}
+	case compiled.pattern != nil:
+		// tag patterns only need to look at the distinct tags
+		for tag, ids := range idx.tags {
+			if compiled.pattern.Match(tag) {
+				set = set.Or(ids)
+			}
+		}
+	default:
+		for id, todo := range idx.todos {
+			if compiled.predicate(todo) {
+				set.Add(id)
+			}
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,117 @@
+package tagquery
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+)
+
+func TestTagQueryToken_Execute(t *testing.T) {
+	todos := parseTodos(t, "note.md", "",
+		"- [ ] #task #Project/alpha @alice due:2024-05-10",
+		"- [x] #task #project/beta @bob",
+		"- [ ] #task #client-7 @Alice @bob",
+		"- [ ] #task #projects",
+	)
+	env := Env{Now: time.Date(2024, 5, 15, 9, 0, 0, 0, time.Local)}
+	// duplicates are indexed once, at their first position
+	idx := NewIndex(append(todos, todos[1], todos[0]))
+
+	tests := map[string][]*models.Todo{
+		"#project":                         {todos[0], todos[1]},
+		"#project OR @alice":               {todos[0], todos[1], todos[2]},
+		"@alice OR #project":               {todos[0], todos[1], todos[2]},
+		"#project AND @bob":                {todos[1]},
+		"/#Project/ OR #client-*":          {todos[0], todos[2]},
+		"#task AND NOT (#proj* OR @bob)":   {},
+		"NOT @alice AND NOT is:closed":     {todos[3]},
+		"due:overdue OR (@bob AND !#task)": {todos[0]},
+		"#task AND #task AND #task":        {todos[0], todos[1], todos[2], todos[3]},
+		"#none":                            {},
+	}
+	for query, want := range tests {
+		tree, err := ParseWith(query, env)
+		if err != nil {
+			t.Errorf("ParseWith(%q) error = %v", query, err)
+			continue
+		}
+		got, err := tree.Execute(idx, env)
+		if err != nil {
+			t.Errorf("%q: Execute() error = %v", query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: Execute() = %v, want %v", query, got, want)
+		}
+
+		// evaluating todo by todo gives the same result
+		predicates := map[string]Predicate{}
+		tree.walkTerms(func(term string) {
+			predicates[term], _ = ParseTerm(term, env)
+		})
+		slow := tree.Eval(todos, func(todo *models.Todo, term string) bool {
+			return predicates[term](todo)
+		})
+		if !reflect.DeepEqual(slow, want) {
+			t.Errorf("%q: Eval() = %v, want %v", query, slow, want)
+		}
+	}
+}
+
+func TestIndex_With(t *testing.T) {
+	todos := parseTodos(t, "note.md", "",
+		"- [ ] #task #project @alice",
+		"- [ ] #task #project",
+	)
+	idx := NewIndex(todos)
+	if !idx.Indexes(todos) || idx.Indexes(todos[:1]) {
+		t.Errorf("Indexes() doesn't compare the indexed todos")
+	}
+
+	copies := []*models.Todo{}
+	for _, todo := range todos {
+		c := *todo
+		c.Closed = true
+		copies = append(copies, &c)
+	}
+	tree, err := Parse("#project AND is:closed AND NOT @alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tree.Execute(idx.With(copies), Env{})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if want := []*models.Todo{copies[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Execute() = %v, want %v", got, want)
+	}
+	if got, _ := tree.Execute(idx, Env{}); len(got) != 0 {
+		t.Errorf("With() changed the todos of idx: %v", got)
+	}
+}
+
+func BenchmarkTagQueryToken_Filter(b *testing.B) {
+	todos := []*models.Todo{}
+	for i := 0; i < 50000; i++ {
+		todos = append(todos, &models.Todo{
+			Text:      fmt.Sprintf("todo %d", i),
+			Tags:      []string{"#task", fmt.Sprintf("#project/p%d", i%100), fmt.Sprintf("#area/a%d", i%7)},
+			Assignees: []string{fmt.Sprintf("person%d", i%20)},
+			Closed:    i%3 == 0,
+		})
+	}
+	tree, err := Parse("#task AND (#project/p1* OR #area/a3) AND NOT (@person4 OR is:closed)")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tree.Filter(todos, Env{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package tagquery
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenKind tells operators, parentheses and terms of a query apart
+type TokenKind int
+
+const (
+	TOKEN_TERM TokenKind = iota
+	TOKEN_AND
+	TOKEN_OR
+	TOKEN_NOT
+	TOKEN_LPAREN
+	TOKEN_RPAREN
+	TOKEN_EOF
+)
+
+// operators maps the keywords of the query language to their token kinds.
+// Quoted keywords are terms.
+var operators = map[string]TokenKind{
+	"AND": TOKEN_AND,
+	"OR":  TOKEN_OR,
+	"NOT": TOKEN_NOT,
+}
+
+// Token is a lexical unit of a query
+type Token struct {
+	Kind TokenKind
+	// Text is the term without quotes, or the operator as written
+	Text string
+	// Col is the 1 based byte column the token starts at
+	Col int
+}
+
+// QueryError describes why a query can't be parsed. It wraps
+// INVALID_QUERY_ERROR.
+type QueryError struct {
+	// Token is the offending token, empty at the end of the query
+	Token string `json:"token"`
+	// Col is the 1 based byte column of the offending token
+	Col int `json:"col"`
+	// Message says what was expected instead
+	Message string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%v: %s at column %d", INVALID_QUERY_ERROR, e.Message, e.Col)
+	}
+	return fmt.Sprintf("%v: %s at column %d near '%s'", INVALID_QUERY_ERROR, e.Message, e.Col, e.Token)
+}
+
+func (e *QueryError) Unwrap() error {
+	return INVALID_QUERY_ERROR
+}
+
+// Tokenize splits query into tokens. Terms end at whitespace and
+// parentheses. Double quotes group text with whitespace into a term, like
+// "some tag" or heading:"Sprint 12", and can contain \" and \\. Terms
+// starting with / are regular expressions up to the next unescaped /, they
+// can contain whitespace and parentheses. A leading ! negates the term or
+// parenthesis that follows it, like NOT does. The last token is always
+// TOKEN_EOF.
+func Tokenize(query string) ([]Token, error) {
+	tokens := []Token{}
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, Token{Kind: TOKEN_LPAREN, Text: "(", Col: i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, Token{Kind: TOKEN_RPAREN, Text: ")", Col: i + 1})
+			i++
+		case c == '!':
+			tokens = append(tokens, Token{Kind: TOKEN_NOT, Text: "!", Col: i + 1})
+			i++
+		default:
+			start := i
+			term, quoted, end, err := readTerm(query, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			kind, isOperator := operators[term]
+			if quoted || !isOperator {
+				kind = TOKEN_TERM
+			}
+			tokens = append(tokens, Token{Kind: kind, Text: term, Col: start + 1})
+		}
+	}
+	return append(tokens, Token{Kind: TOKEN_EOF, Col: len(query) + 1}), nil
+}
+
+// readTerm reads the term starting at byte start of query. It returns the
+// term without quotes, whether part of it was quoted and the offset after
+// the term.
+func readTerm(query string, start int) (string, bool, int, error) {
+	b := strings.Builder{}
+	quoted := false
+	i := start
+	for i < len(query) {
+		c := query[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(' || c == ')' {
+			break
+		}
+		if c == '/' && i == start {
+			end := regexEnd(query, i)
+			if end < 0 {
+				return "", false, 0, &QueryError{Token: query[i:], Col: i + 1, Message: "unterminated regular expression"}
+			}
+			b.WriteString(query[i:end])
+			i = end
+			continue
+		}
+		if c != '"' {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+
+		quoted = true
+		open := i
+		i++
+		for {
+			if i >= len(query) {
+				return "", false, 0, &QueryError{Token: query[open:], Col: open + 1, Message: "unterminated quote"}
+			}
+			if query[i] == '\\' && i+1 < len(query) && (query[i+1] == '"' || query[i+1] == '\\') {
+				b.WriteByte(query[i+1])
+				i += 2
+				continue
+			}
+			if query[i] == '"' {
+				i++
+				break
+			}
+			b.WriteByte(query[i])
+			i++
+		}
+	}
+	return b.String(), quoted, i, nil
+}
+
+// regexEnd returns the offset after the slash closing the regular expression
+// that starts at start, or -1 if it isn't closed. Slashes escaped with \ don't
+// close it.
+func regexEnd(query string, start int) int {
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '/':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// Parse parses query into a tree of TagQueryTokens. The grammar is
+//
+//	query   = or
+//	or      = and { "OR" and }
+//	and     = not { "AND" not }
+//	not     = ( "NOT" | "!" ) not | primary
+//	primary = term | "(" or ")"
+//
+// so NOT binds stronger than AND, and AND stronger than OR. Terms are
+// checked with ParseTerm, for state: predicates against the default states.
+// Syntax errors are returned as *QueryError.
+func Parse(query string) (*TagQueryToken, error) {
+	return ParseWith(query, Env{})
+}
+
+// ParseWith parses query like Parse, checking its terms against env
+func ParseWith(query string, env Env) (*TagQueryToken, error) {
+	tokens, err := Tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokens(tokens, env)
+}
+
+func parseTokens(tokens []Token, env Env) (*TagQueryToken, error) {
+	p := &parser{tokens: tokens, env: env}
+	tree, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.Kind != TOKEN_EOF {
+		return nil, p.errorAt(next, "expected AND, OR or the end of the query")
+	}
+	return tree, nil
+}
+
+type parser struct {
+	tokens []Token
+	pos    int
+	env    Env
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() Token {
+	t := p.tokens[p.pos]
+	if t.Kind != TOKEN_EOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorAt(t Token, message string) *QueryError {
+	return &QueryError{Token: t.Text, Col: t.Col, Message: message}
+}
+
+func (p *parser) or() (*TagQueryToken, error) {
+	return p.binary(TOKEN_OR, "OR", p.and)
+}
+
+func (p *parser) and() (*TagQueryToken, error) {
+	return p.binary(TOKEN_AND, "AND", p.not)
+}
+
+// binary parses operands joined by the operator kind, grouping them from
+// the left
+func (p *parser) binary(kind TokenKind, content string, operand func() (*TagQueryToken, error)) (*TagQueryToken, error) {
+	lhs, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Kind == kind {
+		p.next()
+		rhs, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		node := NewToken(content)
+		node.SetLhs(lhs)
+		node.SetRhs(rhs)
+		lhs = node
+	}
+	return lhs, nil
+}
+
+func (p *parser) not() (*TagQueryToken, error) {
+	if p.peek().Kind != TOKEN_NOT {
+		return p.primary()
+	}
+	p.next()
+	operand, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	node := NewToken("NOT")
+	node.SetLhs(operand)
+	return node, nil
+}
+
+func (p *parser) primary() (*TagQueryToken, error) {
+	t := p.next()
+	switch t.Kind {
+	case TOKEN_TERM:
+		if _, err := ParseTerm(t.Text, p.env); err != nil {
+			return nil, p.errorAt(t, err.Error())
+		}
+		return NewToken(t.Text), nil
+	case TOKEN_LPAREN:
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.Kind != TOKEN_RPAREN {
+			if closing.Kind == TOKEN_EOF {
+				return nil, p.errorAt(t, "unclosed parenthesis")
+			}
+			return nil, p.errorAt(closing, "expected AND, OR or )")
+		}
+		return inner, nil
+	case TOKEN_EOF:
+		return nil, p.errorAt(t, "expected a term")
+	default:
+		return nil, p.errorAt(t, "expected a term, NOT or (")
+	}
+}
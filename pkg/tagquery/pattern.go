@@ -0,0 +1,121 @@
+package tagquery
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+)
+
+// PatternKind tells how a Pattern compares tags
+type PatternKind int
+
+const (
+	// PATTERN_EXACT matches the tag and the tags nested below it, see
+	// models.TagMatches
+	PATTERN_EXACT PatternKind = iota
+	// PATTERN_GLOB matches tags with * for any text, ? for a single
+	// character and [...] for a character class. A single trailing * is a
+	// prefix match, like #proj*.
+	PATTERN_GLOB
+	// PATTERN_REGEX matches tags containing a match of a regular expression
+	// written between slashes, like /#client-\d+/
+	PATTERN_REGEX
+)
+
+// Pattern matches tags. Exact and glob patterns ignore case and the leading #
+// is optional, regular expressions are used as written.
+type Pattern struct {
+	Raw  string
+	Kind PatternKind
+	re   *regexp.Regexp
+}
+
+// ParsePattern parses a tag pattern. Terms between slashes are regular
+// expressions, terms with *, ? or [ globs and everything else exact tags.
+func ParsePattern(raw string) (*Pattern, error) {
+	p := &Pattern{Raw: raw}
+	switch {
+	case isRegex(raw):
+		re, err := regexp.Compile(raw[1 : len(raw)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %w", raw, err)
+		}
+		p.Kind = PATTERN_REGEX
+		p.re = re
+	case strings.ContainsAny(raw, "*?["):
+		re, err := globToRegex(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %w", raw, err)
+		}
+		p.Kind = PATTERN_GLOB
+		p.re = re
+	}
+	return p, nil
+}
+
+func isRegex(raw string) bool {
+	return len(raw) >= 2 && strings.HasPrefix(raw, "/") && strings.HasSuffix(raw, "/")
+}
+
+// globToRegex translates a glob into an anchored, case insensitive regular
+// expression. Globs that don't start with a wildcard get a leading # if they
+// lack one.
+func globToRegex(glob string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(glob, "#") && !strings.ContainsAny(glob[:1], "*?[") {
+		glob = "#" + glob
+	}
+	b := strings.Builder{}
+	b.WriteString("(?i)^")
+	// runes, so tags with unicode letters aren't split into bytes
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			rest := string(runes[i+1:])
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			class := rest[:end]
+			i += utf8.RuneCountInString(class) + 1
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Match reports whether tag matches the pattern
+func (p *Pattern) Match(tag string) bool {
+	if p.Kind == PATTERN_EXACT {
+		return models.TagMatches(tag, p.Raw)
+	}
+	return p.re.MatchString(tag)
+}
+
+// MatchTodo reports whether one of the tags of todo matches the pattern
+func (p *Pattern) MatchTodo(todo *models.Todo) bool {
+	return p.MatchAny(todo.Tags)
+}
+
+// MatchAny reports whether one of tags matches the pattern
+func (p *Pattern) MatchAny(tags []string) bool {
+	for _, tag := range tags {
+		if p.Match(tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package tagquery
+
+import (
+	"testing"
+)
+
+func TestPattern_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		tag     string
+		want    bool
+	}{
+		{"#work", "#work", true},
+		{"work", "#Work", true},
+		{"#work", "#work/meetings", true},
+		{"#work", "#workshop", false},
+		{"#proj*", "#project", true},
+		{"proj*", "#projects/alpha", true},
+		{"#proj*", "#myproject", false},
+		{"#client-?", "#client-1", true},
+		{"#client-?", "#client-12", false},
+		{"*/alpha", "#project/alpha", true},
+		{"#[ab]*", "#beta", true},
+		{"#[!ab]*", "#beta", false},
+		{`/#client-\d+/`, "#client-42", true},
+		{`/#client-\d+/`, "#client-x", false},
+		{`/^#a\/b$/`, "#a/b", true},
+		{"#über*", "#über", true},
+		{"#über*", "#überall", true},
+		{"#café/*", "#café/x", true},
+		{"#caf?", "#café", true},
+		{"#[äö]l", "#öl", true},
+		{"#größe", "#Größe/x", true},
+	}
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Errorf("ParsePattern(%q) error = %v", tt.pattern, err)
+			continue
+		}
+		if got := p.Match(tt.tag); got != tt.want {
+			t.Errorf("ParsePattern(%q).Match(%q) = %v, want %v", tt.pattern, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestParsePatternErrors(t *testing.T) {
+	for _, raw := range []string{"/(/", "#a[b"} {
+		if _, err := ParsePattern(raw); err == nil {
+			t.Errorf("ParsePattern(%q) didn't fail", raw)
+		}
+	}
+}
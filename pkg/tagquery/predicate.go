@@ -0,0 +1,458 @@
+package tagquery
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/dates"
+	"github.com/mrWinston/granite.nvim/pkg/models"
+)
+
+// Predicate reports whether a todo matches a term
+type Predicate func(todo *models.Todo) bool
+
+// Env holds what the predicates of a query are evaluated against
+type Env struct {
+	// Now is the date relative dates like today+7d are resolved against
+	Now time.Time
+	// States resolves the states of state: predicates. Defaults to
+	// models.DefaultStateConfig
+	States *models.StateConfig
+	// Root is the folder file: globs are relative to
+	Root string
+}
+
+// predicateRegex splits terms like due<today+7d into key, operator and value.
+// Tags can't contain these operators, so a term matching it is never a tag.
+var predicateRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*)(<=|>=|!=|<|>|=|:|~)(.*)$`)
+
+// ParseTerm compiles a term of a query into a predicate. Terms are
+//
+//	@name         todos assigned to name
+//	key:value     predicates on fields, like state:OPEN or due<today+7d
+//	anything else tag patterns, see ParsePattern
+//
+// Predicates compare with : or = (equal), != , <, <=, > and >=. Text
+// predicates also take ~, which matches a substring or a regular expression
+// between slashes. The keys are
+//
+//	is          blocked, actionable, open, closed, overdue, recurring or running
+//	has         due, estimate, assignee, clock, recurrence, dependency, notes,
+//	            subtasks or the name of any inline field
+//	state       a state name or marker
+//	tag         a tag pattern
+//	assignee    a person, without the leading @
+//	file        a glob on the path relative to Env.Root, ** matches folders
+//	text        the text of the todo
+//	heading     the heading the todo is placed under
+//	priority    none, low, medium or high
+//	urgency     a number
+//	estimate    a duration like 2h or 1d
+//	due, created, done and other date fields
+//	            a date, a relative date like today+7d or overdue
+//
+// Other keys compare the inline field with that name, as date, number,
+// duration or text depending on the field.
+func ParseTerm(term string, env Env) (Predicate, error) {
+	compiled, err := compileTerm(term, env)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.predicate, nil
+}
+
+// compiledTerm is a term classified and compiled by compileTerm
+type compiledTerm struct {
+	// assignee is the lower cased name of @name terms
+	assignee string
+	// pattern is set for tag patterns
+	pattern *Pattern
+	// predicate matches todos against the term, whatever kind it is
+	predicate Predicate
+}
+
+// compileTerm works out which kind of term term is and compiles its
+// predicate, see ParseTerm
+func compileTerm(term string, env Env) (compiledTerm, error) {
+	if strings.HasPrefix(term, "@") {
+		return compiledTerm{
+			assignee: strings.ToLower(strings.TrimPrefix(term, "@")),
+			predicate: func(todo *models.Todo) bool {
+				return todo.HasAssignee(term)
+			},
+		}, nil
+	}
+
+	m := predicateRegex.FindStringSubmatch(term)
+	if m == nil {
+		pattern, err := ParsePattern(term)
+		if err != nil {
+			return compiledTerm{}, err
+		}
+		return compiledTerm{pattern: pattern, predicate: pattern.MatchTodo}, nil
+	}
+	predicate, err := keyPredicate(strings.ToLower(m[1]), m[2], m[3], env)
+	if err != nil {
+		return compiledTerm{}, err
+	}
+	return compiledTerm{predicate: predicate}, nil
+}
+
+// keyPredicate compiles key:value terms, see ParseTerm
+func keyPredicate(key string, op string, value string, env Env) (Predicate, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing value for %s", key)
+	}
+
+	switch key {
+	case "is":
+		return isPredicate(op, value, env)
+	case "has":
+		return hasPredicate(op, value)
+	case "state":
+		return statePredicate(op, value, env)
+	case "tag":
+		return tagPredicate(op, value)
+	case "assignee":
+		return textPredicate(op, value, func(todo *models.Todo) []string { return todo.Assignees })
+	case "file", "path":
+		return filePredicate(op, value, env)
+	case "text":
+		return textPredicate(op, value, func(todo *models.Todo) []string { return []string{todo.Text} })
+	case "heading":
+		return textPredicate(op, value, func(todo *models.Todo) []string { return []string{todo.Heading} })
+	case "priority":
+		priority, err := models.ParsePriority(value)
+		if err != nil {
+			return nil, err
+		}
+		return orderedPredicate(op, func(todo *models.Todo) (int, bool) {
+			return compareNumbers(float64(todo.Priority), float64(priority)), true
+		})
+	case "urgency":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", value)
+		}
+		return orderedPredicate(op, func(todo *models.Todo) (int, bool) {
+			return compareNumbers(todo.Urgency, n), true
+		})
+	case "estimate":
+		d, ok := models.ParseEstimate(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid duration %s", value)
+		}
+		seconds := int64(d / time.Second)
+		return orderedPredicate(op, func(todo *models.Todo) (int, bool) {
+			return compareNumbers(float64(todo.EstimateSeconds), float64(seconds)), todo.EstimateSeconds > 0
+		})
+	case "due", "created", "done":
+		return datePredicate(op, value, env, todoDate(key))
+	}
+	if slices.Contains(models.DATE_FIELDS, key) {
+		return datePredicate(op, value, env, todoDate(key))
+	}
+	return fieldPredicate(key, op, value, env)
+}
+
+// todoDate returns the getter of a date of todos
+func todoDate(key string) func(todo *models.Todo) string {
+	switch key {
+	case "due":
+		return func(todo *models.Todo) string { return todo.DueDate }
+	case "created":
+		return func(todo *models.Todo) string { return todo.CreatedDate }
+	case "done":
+		return func(todo *models.Todo) string { return todo.CompletedDate }
+	}
+	return func(todo *models.Todo) string {
+		if field, ok := todo.Fields[key]; ok {
+			return field.Date
+		}
+		return ""
+	}
+}
+
+func isPredicate(op string, value string, env Env) (Predicate, error) {
+	if op != ":" && op != "=" {
+		return nil, fmt.Errorf("is only supports :")
+	}
+	today := dates.Day(env.Now).Format(models.DATE_FORMAT)
+	switch strings.ToLower(value) {
+	case "blocked":
+		return func(todo *models.Todo) bool { return todo.Blocked }, nil
+	case "actionable":
+		return func(todo *models.Todo) bool { return todo.Actionable }, nil
+	case "open":
+		return func(todo *models.Todo) bool { return !todo.Closed }, nil
+	case "closed":
+		return func(todo *models.Todo) bool { return todo.Closed }, nil
+	case "overdue":
+		return func(todo *models.Todo) bool { return isOverdue(todo.DueDate, todo, today) }, nil
+	case "recurring":
+		return func(todo *models.Todo) bool { return todo.Recurrence != nil }, nil
+	case "running":
+		return func(todo *models.Todo) bool {
+			_, running := todo.RunningClock()
+			return running
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown condition is:%s", value)
+}
+
+func isOverdue(date string, todo *models.Todo, today string) bool {
+	return !todo.Closed && date != "" && date < today
+}
+
+func hasPredicate(op string, value string) (Predicate, error) {
+	if op != ":" && op != "=" {
+		return nil, fmt.Errorf("has only supports :")
+	}
+	key := strings.ToLower(value)
+	switch key {
+	case "due":
+		return func(todo *models.Todo) bool { return todo.DueDate != "" }, nil
+	case "estimate":
+		return func(todo *models.Todo) bool { return todo.EstimateSeconds > 0 }, nil
+	case "assignee":
+		return func(todo *models.Todo) bool { return len(todo.Assignees) > 0 }, nil
+	case "clock":
+		return func(todo *models.Todo) bool { return len(todo.Clocks) > 0 }, nil
+	case "recurrence":
+		return func(todo *models.Todo) bool { return todo.Recurrence != nil }, nil
+	case "dependency":
+		return func(todo *models.Todo) bool { return len(todo.DependsOn) > 0 }, nil
+	case "notes":
+		return func(todo *models.Todo) bool { return todo.Notes != "" }, nil
+	case "subtasks":
+		return func(todo *models.Todo) bool { return len(todo.Children) > 0 }, nil
+	}
+	return func(todo *models.Todo) bool {
+		_, ok := todo.Fields[key]
+		return ok
+	}, nil
+}
+
+func statePredicate(op string, value string, env Env) (Predicate, error) {
+	states := env.States
+	if states == nil {
+		states = models.DefaultStateConfig
+	}
+	state, err := states.Resolve(value)
+	if err != nil {
+		return nil, fmt.Errorf("unknown state %s", value)
+	}
+	return equalityPredicate(op, func(todo *models.Todo) bool {
+		return todo.StateString == state.Name
+	})
+}
+
+func tagPredicate(op string, value string) (Predicate, error) {
+	pattern, err := ParsePattern(value)
+	if err != nil {
+		return nil, err
+	}
+	return equalityPredicate(op, pattern.MatchTodo)
+}
+
+func filePredicate(op string, value string, env Env) (Predicate, error) {
+	re, err := fileGlobToRegex(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %s: %w", value, err)
+	}
+	// globs without a folder match the file name in any folder
+	base := !strings.Contains(value, "/")
+	return equalityPredicate(op, func(todo *models.Todo) bool {
+		path := todo.FilePath
+		if rel, err := filepath.Rel(env.Root, path); env.Root != "" && err == nil {
+			path = rel
+		}
+		path = filepath.ToSlash(path)
+		if base {
+			path = filepath.Base(path)
+		}
+		return re.MatchString(path)
+	})
+}
+
+// fileGlobToRegex translates a glob on paths into an anchored regular
+// expression. * and ? don't match /, ** matches anything including /.
+func fileGlobToRegex(glob string) (*regexp.Regexp, error) {
+	b := strings.Builder{}
+	b.WriteString("^")
+	// runes, so paths with unicode letters aren't split into bytes
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r, rest := runes[i], string(runes[i:]); {
+		case strings.HasPrefix(rest, "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(rest, "**"):
+			b.WriteString(".*")
+			i++
+		case r == '*':
+			b.WriteString("[^/]*")
+		case r == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// textPredicate compares the texts values returns. : and = ignore case, ~
+// matches a substring ignoring case or a regular expression between slashes.
+func textPredicate(op string, value string, values func(todo *models.Todo) []string) (Predicate, error) {
+	var match func(s string) bool
+	switch op {
+	case ":", "=", "!=":
+		match = func(s string) bool { return strings.EqualFold(s, value) }
+	case "~":
+		if isRegex(value) {
+			re, err := regexp.Compile(value[1 : len(value)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %s: %w", value, err)
+			}
+			match = re.MatchString
+		} else {
+			lower := strings.ToLower(value)
+			match = func(s string) bool { return strings.Contains(strings.ToLower(s), lower) }
+		}
+	default:
+		return nil, fmt.Errorf("operator %s doesn't compare text", op)
+	}
+	matchAny := func(todo *models.Todo) bool {
+		for _, s := range values(todo) {
+			if match(s) {
+				return true
+			}
+		}
+		return false
+	}
+	if op == "!=" {
+		return func(todo *models.Todo) bool { return !matchAny(todo) }, nil
+	}
+	return matchAny, nil
+}
+
+// datePredicate compares the dates of todos date returns with value, a
+// date, a relative date or overdue. Todos without a date never match.
+func datePredicate(op string, value string, env Env, date func(todo *models.Todo) string) (Predicate, error) {
+	if strings.EqualFold(value, "overdue") {
+		today := dates.Day(env.Now).Format(models.DATE_FORMAT)
+		return equalityPredicate(op, func(todo *models.Todo) bool {
+			return isOverdue(date(todo), todo, today)
+		})
+	}
+	want, ok := parseDate(value, env)
+	if !ok {
+		return nil, fmt.Errorf("invalid date %s", value)
+	}
+	return orderedPredicate(op, func(todo *models.Todo) (int, bool) {
+		d := date(todo)
+		// dates are YYYY-MM-DD, so they compare as strings
+		return strings.Compare(d, want), d != ""
+	})
+}
+
+// parseDate parses an absolute or relative date
+func parseDate(value string, env Env) (string, bool) {
+	if d, err := time.Parse(models.DATE_FORMAT, value); err == nil {
+		return d.Format(models.DATE_FORMAT), true
+	}
+	if d, ok := dates.Resolve(value, env.Now); ok {
+		return d.Format(models.DATE_FORMAT), true
+	}
+	return "", false
+}
+
+// fieldPredicate compares the inline field key of todos depending on its
+// type. Todos without the field never match.
+func fieldPredicate(key string, op string, value string, env Env) (Predicate, error) {
+	date, isDate := parseDate(value, env)
+	number, numberErr := strconv.ParseFloat(value, 64)
+	duration, isDuration := models.ParseDuration(value)
+	if op == "~" {
+		text, err := textPredicate(op, value, func(todo *models.Todo) []string {
+			return []string{todo.Fields[key].Raw}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return func(todo *models.Todo) bool {
+			_, ok := todo.Fields[key]
+			return ok && text(todo)
+		}, nil
+	}
+
+	return orderedPredicate(op, func(todo *models.Todo) (int, bool) {
+		field, ok := todo.Fields[key]
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case field.Type == models.FIELD_DATE && isDate && field.Date != "":
+			return strings.Compare(field.Date, date), true
+		case field.Type == models.FIELD_NUMBER && numberErr == nil:
+			return compareNumbers(field.Number, number), true
+		case field.Type == models.FIELD_DURATION && isDuration:
+			return compareNumbers(float64(field.Seconds), float64(duration/time.Second)), true
+		}
+		return strings.Compare(strings.ToLower(field.Raw), strings.ToLower(value)), true
+	})
+}
+
+// equalityPredicate supports : and = for matches and != for the rest
+func equalityPredicate(op string, match Predicate) (Predicate, error) {
+	switch op {
+	case ":", "=":
+		return match, nil
+	case "!=":
+		return func(todo *models.Todo) bool { return !match(todo) }, nil
+	}
+	return nil, fmt.Errorf("operator %s needs an ordered value", op)
+}
+
+// orderedPredicate turns a comparison into a predicate for op. compare
+// returns how the value of todo compares to the one of the term, and false
+// when the todo has none.
+func orderedPredicate(op string, compare func(todo *models.Todo) (int, bool)) (Predicate, error) {
+	var accept func(c int) bool
+	switch op {
+	case ":", "=":
+		accept = func(c int) bool { return c == 0 }
+	case "!=":
+		accept = func(c int) bool { return c != 0 }
+	case "<":
+		accept = func(c int) bool { return c < 0 }
+	case "<=":
+		accept = func(c int) bool { return c <= 0 }
+	case ">":
+		accept = func(c int) bool { return c > 0 }
+	case ">=":
+		accept = func(c int) bool { return c >= 0 }
+	default:
+		return nil, fmt.Errorf("operator %s doesn't compare ordered values", op)
+	}
+	return func(todo *models.Todo) bool {
+		c, ok := compare(todo)
+		return ok && accept(c)
+	}, nil
+}
+
+func compareNumbers(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+package tagquery
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+)
+
+func parseTodos(t *testing.T, path string, heading string, lines ...string) []*models.Todo {
+	t.Helper()
+	todos := []*models.Todo{}
+	for i, line := range lines {
+		todo := &models.Todo{RawLine: line, LineNumber: i + 1, FilePath: path, Heading: heading}
+		if err := todo.Parse(); err != nil {
+			t.Fatalf("Parse(%q) error = %v", line, err)
+		}
+		todos = append(todos, todo)
+	}
+	return todos
+}
+
+func TestParseTerm(t *testing.T) {
+	todos := append(
+		parseTodos(t, "/vault/projects/alpha/plan.md", "Sprint 3",
+			"- [ ] #task deploy the app due:2024-05-14 @alice estimate:2h",
+			"- [x] #task write release notes due:2024-05-16 priority:high",
+			"- [/] #task #client-7 review the deploy script due:2024-05-20 points:3",
+		),
+		parseTodos(t, "/vault/inbox.md", "",
+			"- [ ] #task call the bank every:week",
+			"- [ ] #task #clients renew the domain due:2024-06-30 points:8 [estimate:: 1d]",
+		)...,
+	)
+	env := Env{
+		// a wednesday
+		Now:  time.Date(2024, 5, 15, 9, 0, 0, 0, time.Local),
+		Root: "/vault",
+	}
+
+	tests := map[string][]int{
+		"#task":                   {0, 1, 2, 3, 4},
+		"#client-*":               {2},
+		"#client":                 {},
+		"@alice":                  {0},
+		"state:OPEN":              {0, 3, 4},
+		"state:[/]":               {2},
+		"state!=OPEN":             {1, 2},
+		"is:closed":               {1},
+		"is:recurring":            {3},
+		"due:overdue":             {0},
+		"is:overdue":              {0},
+		"due<today+7d":            {0, 1, 2},
+		"due<today+2d":            {0, 1},
+		"due<=next-mon":           {0, 1, 2},
+		"due>=2024-06-01":         {4},
+		"due:tomorrow":            {1},
+		"has:due":                 {0, 1, 2, 4},
+		"has:points":              {2, 4},
+		"has:estimate":            {0, 4},
+		"file:projects/**":        {0, 1, 2},
+		"file:inbox.md":           {3, 4},
+		"file:*.md":               {0, 1, 2, 3, 4},
+		"file:projects/*.md":      {},
+		`text~deploy`:             {0, 2},
+		`text~/deploy (the|app)/`: {0},
+		"heading:sprint 3":        {0, 1, 2},
+		"heading~sprint":          {0, 1, 2},
+		"priority:high":           {1},
+		"priority>=medium":        {1},
+		"estimate>2h":             {4},
+		"estimate<=2h":            {0},
+		"points>3":                {4},
+		"points:3":                {2},
+		"tag:#client*":            {2, 4},
+		"assignee:ALICE":          {0},
+		"assignee~ali":            {0},
+		"every:week":              {3},
+	}
+	for term, want := range tests {
+		predicate, err := ParseTerm(term, env)
+		if err != nil {
+			t.Errorf("ParseTerm(%q) error = %v", term, err)
+			continue
+		}
+		got := []int{}
+		for i, todo := range todos {
+			if predicate(todo) {
+				got = append(got, i)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q matches %v, want %v", term, got, want)
+		}
+	}
+}
+
+func TestParseTermUnicodeFiles(t *testing.T) {
+	todos := append(
+		parseTodos(t, "/vault/büro/plän.md", "", "- [ ] #task order chairs"),
+		parseTodos(t, "/vault/café/menü.md", "", "- [ ] #task print the menu")...,
+	)
+	env := Env{Root: "/vault"}
+
+	tests := map[string][]int{
+		"file:büro/**":    {0},
+		"file:**/plän.md": {0},
+		"file:café/*.md":  {1},
+		"file:caf?/*":     {1},
+		"file:*/men?.md":  {1},
+	}
+	for term, want := range tests {
+		predicate, err := ParseTerm(term, env)
+		if err != nil {
+			t.Errorf("ParseTerm(%q) error = %v", term, err)
+			continue
+		}
+		got := []int{}
+		for i, todo := range todos {
+			if predicate(todo) {
+				got = append(got, i)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q matches %v, want %v", term, got, want)
+		}
+	}
+}
+
+func TestParseTermErrors(t *testing.T) {
+	for _, term := range []string{
+		"state:WAITING",
+		"due<soon",
+		"due:",
+		"is:pending",
+		"has<due",
+		"priority:urgent",
+		"text<a",
+		"text~/(/",
+		"estimate>later",
+		"tag<#a",
+	} {
+		if _, err := ParseTerm(term, Env{}); err == nil {
+			t.Errorf("ParseTerm(%q) didn't fail", term)
+		}
+	}
+}
+
+func TestTagQueryToken_Filter(t *testing.T) {
+	todos := parseTodos(t, "note.md", "",
+		"- [ ] #task deploy due:2024-05-14",
+		"- [x] #task deploy due:2024-05-10",
+		"- [ ] #task #work review due:2024-05-30",
+	)
+	env := Env{Now: time.Date(2024, 5, 15, 9, 0, 0, 0, time.Local)}
+
+	tree, err := ParseWith(`#task AND (due:overdue OR text~"review") AND NOT is:closed`, env)
+	if err != nil {
+		t.Fatalf("ParseWith() error = %v", err)
+	}
+	got, err := tree.Filter(todos, env)
+	if err != nil {
+		t.Fatalf("Filter() error = %v", err)
+	}
+	if want := []*models.Todo{todos[0], todos[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter() = %v, want %v", got, want)
+	}
+
+	_, err = ParseWith("#task AND state:WAITING", env)
+	if queryErr, ok := err.(*QueryError); !ok || queryErr.Col != 11 || queryErr.Message != "unknown state WAITING" {
+		t.Errorf("ParseWith() error = %v, want unknown state at column 11", err)
+	}
+}
@@ -8,20 +8,35 @@ import (
 	"github.com/mrWinston/granite.nvim/pkg/models"
 )
 
+// TodosOR returns the todos of lhs followed by the todos of rhs that aren't
+// part of lhs, without duplicates
 func TodosOR(lhs []*models.Todo, rhs []*models.Todo) []*models.Todo {
 	out := []*models.Todo{}
-	out = append(out, lhs...)
-	return append(out, rhs...)
+	seen := map[*models.Todo]bool{}
+	for _, todos := range [][]*models.Todo{lhs, rhs} {
+		for _, todo := range todos {
+			if !seen[todo] {
+				seen[todo] = true
+				out = append(out, todo)
+			}
+		}
+	}
+	return out
 }
 
+// TodosAND returns the todos of lhs that are part of rhs, in the order of
+// lhs and without duplicates
 func TodosAND(lhs []*models.Todo, rhs []*models.Todo) []*models.Todo {
 	out := []*models.Todo{}
-
-	for _, l := range lhs {
-		for _, r := range rhs {
-			if l == r {
-				out = append(out, l)
-			}
+	inRhs := map[*models.Todo]bool{}
+	for _, todo := range rhs {
+		inRhs[todo] = true
+	}
+	for _, todo := range lhs {
+		if inRhs[todo] {
+			out = append(out, todo)
+			// later duplicates of todo in lhs are skipped
+			delete(inRhs, todo)
 		}
 	}
 	return out
@@ -84,52 +99,79 @@ func NewToken(c string) *TagQueryToken {
 
 var INVALID_QUERY_ERROR error = errors.New("Could not parse Query")
 
+// BuildTokenTree parses the tokens of QueryToTokens like Parse does. Columns
+// in errors assume the tokens were separated by single spaces.
 func BuildTokenTree(rawTokens []string) (*TagQueryToken, error) {
-	root := &TagQueryToken{}
-
-	currentToken := &TagQueryToken{
-		Parent: root,
-	}
-	root.Lhs = currentToken
-	for _, rawToken := range rawTokens {
-
-		if currentToken == nil {
-			return nil, INVALID_QUERY_ERROR
-		}
-
-		switch rawToken {
+	tokens := []Token{}
+	col := 1
+	for _, raw := range rawTokens {
+		t := Token{Kind: TOKEN_TERM, Text: raw, Col: col}
+		switch raw {
 		case "(":
-			currentToken.SetLhs(NewToken(""))
-			currentToken = currentToken.Lhs
+			t.Kind = TOKEN_LPAREN
 		case ")":
-			currentToken = currentToken.Parent
-		case "AND", "OR":
-			currentToken.Content = rawToken
-			currentToken.SetRhs(NewToken(""))
-			currentToken = currentToken.Rhs
+			t.Kind = TOKEN_RPAREN
 		default:
-			currentToken.Content = rawToken
-			currentToken = currentToken.Parent
+			if kind, ok := operators[raw]; ok {
+				t.Kind = kind
+			}
 		}
+		tokens = append(tokens, t)
+		col += len(raw) + 1
 	}
-	if currentToken != root {
-		return nil, INVALID_QUERY_ERROR
-	}
+	return parseTokens(append(tokens, Token{Kind: TOKEN_EOF, Col: col}), Env{})
+}
+
+// IsTerm reports whether the token is a term rather than an operator. Terms
+// have no operands, so a quoted "AND" is a term as well.
+func (t *TagQueryToken) IsTerm() bool {
+	return t.Lhs == nil && t.Rhs == nil
+}
 
-  for currentToken.Content == "" && currentToken.Rhs == nil {
-    currentToken = currentToken.Lhs
-  }
+// Eval returns the todos matching the tree in the order of todos. match
+// reports whether a todo matches a term.
+func (t *TagQueryToken) Eval(todos []*models.Todo, match func(todo *models.Todo, term string) bool) []*models.Todo {
+	out := []*models.Todo{}
+	for _, todo := range todos {
+		if t.Matches(todo, match) {
+			out = append(out, todo)
+		}
+	}
+	return out
+}
 
+// Filter returns the todos matching the tree in the order of todos, without
+// duplicates. Terms are compiled by ParseTerm against env. See Execute to
+// run several queries on the same todos.
+func (t *TagQueryToken) Filter(todos []*models.Todo, env Env) ([]*models.Todo, error) {
+	return t.Execute(NewIndex(todos), env)
+}
 
-	return currentToken, nil
+// walkTerms calls fn with the content of every term of the tree
+func (t *TagQueryToken) walkTerms(fn func(term string)) {
+	if t.IsTerm() {
+		fn(t.Content)
+		return
+	}
+	for _, child := range []*TagQueryToken{t.Lhs, t.Rhs} {
+		if child != nil {
+			child.walkTerms(fn)
+		}
+	}
 }
 
-func (t *TagQueryToken) GetTodos(filter func(string) []*models.Todo) []*models.Todo {
-  if t.Content == "AND" {
-    return TodosAND(t.Lhs.GetTodos(filter), t.Rhs.GetTodos(filter))
-  }
-  if t.Content == "OR" {
-    return TodosOR(t.Lhs.GetTodos(filter), t.Rhs.GetTodos(filter))
-  }
-  return filter(t.Content)
+// Matches reports whether todo matches the tree, see Eval
+func (t *TagQueryToken) Matches(todo *models.Todo, match func(todo *models.Todo, term string) bool) bool {
+	if t.IsTerm() {
+		return match(todo, t.Content)
+	}
+	switch t.Content {
+	case "AND":
+		return t.Lhs.Matches(todo, match) && t.Rhs.Matches(todo, match)
+	case "OR":
+		return t.Lhs.Matches(todo, match) || t.Rhs.Matches(todo, match)
+	case "NOT":
+		return !t.Lhs.Matches(todo, match)
+	}
+	return false
 }
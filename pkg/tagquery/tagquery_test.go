@@ -1,7 +1,10 @@
 package tagquery
 
 import (
+	"errors"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/mrWinston/granite.nvim/pkg/models"
@@ -12,12 +15,16 @@ func TestTodosOR(t *testing.T) {
 		lhs []*models.Todo
 		rhs []*models.Todo
 	}
+	a, b, c := &models.Todo{Text: "a"}, &models.Todo{Text: "b"}, &models.Todo{Text: "c"}
 	tests := []struct {
 		name string
 		args args
 		want []*models.Todo
 	}{
-		// TODO: Add test cases.
+		{"disjoint", args{[]*models.Todo{a}, []*models.Todo{b}}, []*models.Todo{a, b}},
+		{"overlapping", args{[]*models.Todo{a, b}, []*models.Todo{c, b, a}}, []*models.Todo{a, b, c}},
+		{"duplicates", args{[]*models.Todo{a, a}, nil}, []*models.Todo{a}},
+		{"empty", args{nil, nil}, []*models.Todo{}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -33,12 +40,15 @@ func TestTodosAND(t *testing.T) {
 		lhs []*models.Todo
 		rhs []*models.Todo
 	}
+	a, b, c := &models.Todo{Text: "a"}, &models.Todo{Text: "b"}, &models.Todo{Text: "c"}
 	tests := []struct {
 		name string
 		args args
 		want []*models.Todo
 	}{
-		// TODO: Add test cases.
+		{"disjoint", args{[]*models.Todo{a}, []*models.Todo{b}}, []*models.Todo{}},
+		{"overlapping", args{[]*models.Todo{c, a, b}, []*models.Todo{b, c}}, []*models.Todo{c, b}},
+		{"duplicates", args{[]*models.Todo{a, a}, []*models.Todo{a, a}}, []*models.Todo{a}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -142,13 +152,13 @@ func TestBuildTokenTree(t *testing.T) {
 	q3 := []string{"lskajdf", "lsjdfksdf", "ksjkdfj"}
 	_, err = BuildTokenTree(q3)
 
-	if err != INVALID_QUERY_ERROR {
+	if !errors.Is(err, INVALID_QUERY_ERROR) {
 		t.Errorf("Expected %v but received: %v", INVALID_QUERY_ERROR, err)
 	}
 	q4 := []string{"(", "a", "AND", "b"}
 	_, err = BuildTokenTree(q4)
 
-	if err != INVALID_QUERY_ERROR {
+	if !errors.Is(err, INVALID_QUERY_ERROR) {
 		t.Errorf("Expected an Error in T4, but didn't receive one")
 	}
 }
@@ -268,6 +278,117 @@ func TestNewToken(t *testing.T) {
 	}
 }
 
-func TestTagQueryToken_GetTodos(t *testing.T) {
+func TestTagQueryToken_Eval(t *testing.T) {
+	todos := []*models.Todo{
+		{Text: "a", Tags: []string{"#a"}},
+		{Text: "ab", Tags: []string{"#a", "#b"}},
+		{Text: "c", Tags: []string{"#c"}},
+		{Text: "bc", Tags: []string{"#b", "#c"}},
+	}
+	match := func(todo *models.Todo, term string) bool {
+		return todo.HasTag(term)
+	}
 
+	tests := map[string][]string{
+		"#a":                  {"a", "ab"},
+		"#a OR #b":            {"a", "ab", "bc"},
+		"#a AND #b OR #c":     {"ab", "c", "bc"},
+		"#a AND (#b OR #c)":   {"ab"},
+		"NOT #a":              {"c", "bc"},
+		"!#a AND !#b":         {"c"},
+		"NOT (#a OR #c)":      {},
+		"#c AND NOT NOT #b":   {"bc"},
+		"!(#a AND #b) AND #a": {"a"},
+	}
+	for query, want := range tests {
+		tree, err := Parse(query)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", query, err)
+			continue
+		}
+		got := []string{}
+		for _, todo := range tree.Eval(todos, match) {
+			got = append(got, todo.Text)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q matches %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"a AND b OR c":        "(a AND b) OR c",
+		"a OR b AND c":        "a OR (b AND c)",
+		"a OR b OR c":         "(a OR b) OR c",
+		"NOT a AND b":         "(NOT a) AND b",
+		"!a OR !(b)":          "(NOT a) OR (NOT b)",
+		`"some tag" AND "OR"`: `"some tag" AND "OR"`,
+		`heading:"Sprint 12"`: `"heading:Sprint 12"`,
+		`"say \"hi\""`:        `"say \"hi\""`,
+		`/#a (b|c)/ OR d`:     `"/#a (b|c)/" OR d`,
+	}
+	for query, want := range tests {
+		tree, err := Parse(query)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", query, err)
+			continue
+		}
+		if got := format(tree, true); got != want {
+			t.Errorf("Parse(%q) = %s, want %s", query, got, want)
+		}
+	}
+}
+
+// format prints the tree with explicit parentheses, quoting terms with
+// spaces or quotes and terms looking like operators
+func format(tree *TagQueryToken, top bool) string {
+	if tree.IsTerm() {
+		if _, ok := operators[tree.Content]; ok || strings.ContainsAny(tree.Content, ` "`) {
+			return strconv.Quote(tree.Content)
+		}
+		return tree.Content
+	}
+	var out string
+	if tree.Content == "NOT" {
+		out = "NOT " + format(tree.Lhs, false)
+	} else {
+		out = format(tree.Lhs, false) + " " + tree.Content + " " + format(tree.Rhs, false)
+	}
+	if top {
+		return out
+	}
+	return "(" + out + ")"
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  QueryError
+	}{
+		{"", QueryError{Token: "", Col: 1, Message: "expected a term"}},
+		{"a AND", QueryError{Token: "", Col: 6, Message: "expected a term"}},
+		{"a b", QueryError{Token: "b", Col: 3, Message: "expected AND, OR or the end of the query"}},
+		{"a AND OR b", QueryError{Token: "OR", Col: 7, Message: "expected a term, NOT or ("}},
+		{"(a OR b", QueryError{Token: "(", Col: 1, Message: "unclosed parenthesis"}},
+		{"(a OR b c)", QueryError{Token: "c", Col: 9, Message: "expected AND, OR or )"}},
+		{"a OR b)", QueryError{Token: ")", Col: 7, Message: "expected AND, OR or the end of the query"}},
+		{`a AND "b`, QueryError{Token: `"b`, Col: 7, Message: "unterminated quote"}},
+		{`a OR /#b`, QueryError{Token: "/#b", Col: 6, Message: "unterminated regular expression"}},
+		{`a OR /#b(/`, QueryError{Token: "/#b(/", Col: 6, Message: "invalid regular expression /#b(/: error parsing regexp: missing closing ): `#b(`"}},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		queryErr := &QueryError{}
+		if !errors.As(err, &queryErr) {
+			t.Errorf("Parse(%q) error = %v, want a QueryError", tt.query, err)
+			continue
+		}
+		if *queryErr != tt.want {
+			t.Errorf("Parse(%q) error = %+v, want %+v", tt.query, *queryErr, tt.want)
+		}
+		if !errors.Is(err, INVALID_QUERY_ERROR) {
+			t.Errorf("Parse(%q) error doesn't wrap INVALID_QUERY_ERROR", tt.query)
+		}
+	}
 }
@@ -0,0 +1,142 @@
+package textedit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Edit replaces the text between a start and an end position with Lines.
+// Rows are 0 based, columns are 0 based byte offsets and the end is
+// exclusive, the same as nvim_buf_set_text expects them.
+type Edit struct {
+	StartRow int      `msgpack:"start_row" json:"start_row"`
+	StartCol int      `msgpack:"start_col" json:"start_col"`
+	EndRow   int      `msgpack:"end_row" json:"end_row"`
+	EndCol   int      `msgpack:"end_col" json:"end_col"`
+	Lines    []string `msgpack:"lines" json:"lines"`
+}
+
+// Insert creates an edit that inserts text at row and col. Multiple lines
+// are joined with newlines.
+func Insert(row int, col int, lines ...string) Edit {
+	return Edit{
+		StartRow: row,
+		StartCol: col,
+		EndRow:   row,
+		EndCol:   col,
+		Lines:    lines,
+	}
+}
+
+// Replace creates an edit that replaces the text between col and endCol in
+// row with text
+func Replace(row int, col int, endCol int, text string) Edit {
+	return Edit{
+		StartRow: row,
+		StartCol: col,
+		EndRow:   row,
+		EndCol:   endCol,
+		Lines:    []string{text},
+	}
+}
+
+// InsertLines creates an edit that inserts whole lines before row
+func InsertLines(row int, lines ...string) Edit {
+	return Insert(row, 0, append(lines, "")...)
+}
+
+// Sort orders edits from the end of the text to the start, so applying them
+// one after another doesn't shift the positions of the remaining ones
+func Sort(edits []Edit) []Edit {
+	sorted := append([]Edit{}, edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].StartRow != sorted[j].StartRow {
+			return sorted[i].StartRow > sorted[j].StartRow
+		}
+		return sorted[i].StartCol > sorted[j].StartCol
+	})
+	return sorted
+}
+
+// Apply applies edits to source. Edits must not overlap.
+func Apply(source []byte, edits []Edit) ([]byte, error) {
+	out := append([]byte{}, source...)
+	for _, e := range Sort(edits) {
+		lineStarts := lineOffsets(out)
+		start, err := offset(out, lineStarts, e.StartRow, e.StartCol)
+		if err != nil {
+			return nil, err
+		}
+		end, err := offset(out, lineStarts, e.EndRow, e.EndCol)
+		if err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, fmt.Errorf("Edit ends before it starts: %+v", e)
+		}
+
+		replacement := []byte(strings.Join(e.Lines, "\n"))
+		out = append(out[:start], append(replacement, out[end:]...)...)
+	}
+	return out, nil
+}
+
+func lineOffsets(source []byte) []int {
+	starts := []int{0}
+	for i, b := range source {
+		if b == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func offset(source []byte, lineStarts []int, row int, col int) (int, error) {
+	if row < 0 || row >= len(lineStarts) {
+		return 0, fmt.Errorf("Row %d is out of range", row)
+	}
+	lineEnd := len(source)
+	if row+1 < len(lineStarts) {
+		lineEnd = lineStarts[row+1] - 1
+	}
+	if col < 0 || lineStarts[row]+col > lineEnd {
+		return 0, fmt.Errorf("Column %d is out of range in row %d", col, row)
+	}
+	return lineStarts[row] + col, nil
+}
+
+// WriteFileAtomic replaces the file at path with content. The content is
+// written to a temporary file next to it first, so readers never see a
+// partially written file.
+func WriteFileAtomic(path string, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
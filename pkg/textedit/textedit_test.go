@@ -0,0 +1,51 @@
+package textedit
+
+import (
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	source := []byte("- [ ] one\n- [ ] two\n")
+
+	tests := []struct {
+		name  string
+		edits []Edit
+		want  string
+	}{
+		{
+			name:  "replace marker",
+			edits: []Edit{Replace(1, 2, 5, "[x]")},
+			want:  "- [ ] one\n- [x] two\n",
+		},
+		{
+			name:  "insert at line end",
+			edits: []Edit{Insert(0, 9, " ^t-abc")},
+			want:  "- [ ] one ^t-abc\n- [ ] two\n",
+		},
+		{
+			name:  "insert lines and replace before them",
+			edits: []Edit{InsertLines(1, "  notes"), Replace(0, 2, 5, "[/]")},
+			want:  "- [/] one\n  notes\n- [ ] two\n",
+		},
+		{
+			name:  "append at end of file",
+			edits: []Edit{InsertLines(2, "- [ ] three")},
+			want:  "- [ ] one\n- [ ] two\n- [ ] three\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(source, tt.edits)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Apply(source, []Edit{Replace(0, 5, 20, "")}); err == nil {
+		t.Errorf("expected an error for an edit past the end of the line")
+	}
+}
@@ -0,0 +1,155 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// ignorePattern is a single line of a gitignore style file
+type ignorePattern struct {
+	raw      string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	segments []string
+}
+
+// IgnoreList is the parsed content of a gitignore style file. Patterns are
+// relative to Base, the slash separated directory of the file relative to the
+// vault root. The root itself is "".
+type IgnoreList struct {
+	Base     string
+	patterns []*ignorePattern
+}
+
+// ParseIgnore parses content using the gitignore syntax
+func ParseIgnore(base string, content []byte) *IgnoreList {
+	list := &IgnoreList{Base: base}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		p := parseIgnorePattern(scanner.Text())
+		if p != nil {
+			list.patterns = append(list.patterns, p)
+		}
+	}
+	return list
+}
+
+// NewIgnoreList creates an IgnoreList from single patterns, as if they were
+// the lines of an ignore file in base
+func NewIgnoreList(base string, patterns []string) (*IgnoreList, error) {
+	list := &IgnoreList{Base: base}
+	for _, raw := range patterns {
+		p := parseIgnorePattern(raw)
+		if p == nil {
+			continue
+		}
+		for _, segment := range p.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, err
+			}
+		}
+		list.patterns = append(list.patterns, p)
+	}
+	return list, nil
+}
+
+func parseIgnorePattern(line string) *ignorePattern {
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	p := &ignorePattern{raw: line}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// a slash anywhere but at the end anchors the pattern to the base dir
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return nil
+	}
+	p.segments = strings.Split(line, "/")
+	return p
+}
+
+// trimTrailingSpaces removes trailing spaces unless they are escaped
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Match checks rel, a slash separated path relative to the vault root,
+// against the list. matched is false when no pattern applies, otherwise
+// ignored tells whether the last matching pattern ignores or re-includes
+// the path.
+func (l *IgnoreList) Match(rel string, isDir bool) (matched bool, ignored bool) {
+	if l.Base != "" {
+		if !strings.HasPrefix(rel, l.Base+"/") {
+			return false, false
+		}
+		rel = rel[len(l.Base)+1:]
+	}
+	parts := strings.Split(rel, "/")
+
+	for _, p := range l.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.matches(parts) {
+			matched = true
+			ignored = !p.negate
+		}
+	}
+	return matched, ignored
+}
+
+func (p *ignorePattern) matches(parts []string) bool {
+	if !p.anchored {
+		ok, _ := path.Match(p.segments[0], parts[len(parts)-1])
+		return ok
+	}
+	return matchSegments(p.segments, parts)
+}
+
+func matchSegments(pattern []string, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		// a trailing ** matches everything inside, but not the dir itself
+		if len(pattern) == 1 {
+			return len(parts) > 0
+		}
+		for skip := 0; skip <= len(parts); skip++ {
+			if matchSegments(pattern[1:], parts[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
@@ -0,0 +1,248 @@
+package vault
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IGNORE_FILES are read in every directory of the vault, later files take
+// precedence over earlier ones
+var IGNORE_FILES = []string{".gitignore", ".graniteignore"}
+
+var (
+	DefaultExtensions = []string{".md", ".markdown", ".mdx"}
+	DefaultExclude    = []string{"node_modules/"}
+)
+
+// Config selects the files of a vault that are treated as notes
+type Config struct {
+	// Extensions are the file extensions of notes, including the leading dot
+	Extensions []string
+	// Include are gitignore style patterns relative to the root. When set,
+	// only notes matching one of them are considered.
+	Include []string
+	// Exclude are gitignore style patterns relative to the root. They are
+	// applied before any ignore file found in the vault.
+	Exclude []string
+}
+
+// Rules decides which files below Root are notes, based on the configured
+// extensions and globs and on the ignore files found in the vault. It is
+// shared by every scanner of the vault.
+type Rules struct {
+	Root       string
+	extensions []string
+	include    *IgnoreList
+	exclude    *IgnoreList
+
+	mu      sync.Mutex
+	ignores map[string][]*IgnoreList
+}
+
+// NewRules validates cfg and creates the rules for the vault in root
+func NewRules(root string, cfg Config) (*Rules, error) {
+	extensions := cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	exclude := cfg.Exclude
+	if exclude == nil {
+		exclude = DefaultExclude
+	}
+
+	r := &Rules{
+		Root:    root,
+		ignores: map[string][]*IgnoreList{},
+	}
+	for _, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		r.extensions = append(r.extensions, strings.ToLower(ext))
+	}
+
+	var err error
+	r.exclude, err = NewIgnoreList("", exclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Include) > 0 {
+		r.include, err = NewIgnoreList("", cfg.Include)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Notes walks the vault and returns all notes in lexical order
+func (r *Rules) Notes(ctx context.Context) ([]string, error) {
+	found := []string{}
+	err := filepath.WalkDir(r.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, ok := r.rel(p)
+		if !ok {
+			return nil
+		}
+
+		if d.IsDir() {
+			if rel != "" && r.ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			// pick up changes to the ignore files of this directory
+			r.loadIgnores(rel)
+			return nil
+		}
+
+		if r.isNote(rel) {
+			found = append(found, p)
+		}
+		return nil
+	})
+	return found, err
+}
+
+// IsNote reports whether the file at p is a note of the vault
+func (r *Rules) IsNote(p string) bool {
+	rel, ok := r.rel(p)
+	if !ok || rel == "" {
+		return false
+	}
+	dir := path.Dir(rel)
+	for dir != "." {
+		if r.ignored(dir, true) {
+			return false
+		}
+		dir = path.Dir(dir)
+	}
+	return r.isNote(rel)
+}
+
+// SkipDir reports whether the directory at p is ignored
+func (r *Rules) SkipDir(p string) bool {
+	rel, ok := r.rel(p)
+	if !ok {
+		return true
+	}
+	return rel != "" && r.ignored(rel, true)
+}
+
+func (r *Rules) isNote(rel string) bool {
+	if !r.hasExtension(rel) || r.ignored(rel, false) {
+		return false
+	}
+	if r.include != nil {
+		return r.included(rel)
+	}
+	return true
+}
+
+// included applies the include patterns to rel and its parent directories
+// like an ignore file, so projects/ includes every note below projects. The
+// deepest match wins.
+func (r *Rules) included(rel string) bool {
+	included := false
+	for _, dir := range parentDirs(rel) {
+		if matched, inc := r.include.Match(dir, true); matched {
+			included = inc
+		}
+	}
+	if matched, inc := r.include.Match(rel, false); matched {
+		included = inc
+	}
+	return included
+}
+
+func (r *Rules) hasExtension(rel string) bool {
+	ext := strings.ToLower(path.Ext(rel))
+	for _, e := range r.extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored applies the configured excludes and every ignore file between the
+// root and the parent of rel, the last matching pattern wins
+func (r *Rules) ignored(rel string, isDir bool) bool {
+	if path.Base(rel) == ".git" {
+		return true
+	}
+
+	_, ignored := r.exclude.Match(rel, isDir)
+
+	// go from the root down so deeper ignore files win
+	dirs := append([]string{""}, parentDirs(rel)...)
+
+	for _, dir := range dirs {
+		for _, list := range r.cachedIgnores(dir) {
+			if matched, ign := list.Match(rel, isDir); matched {
+				ignored = ign
+			}
+		}
+	}
+	return ignored
+}
+
+// parentDirs returns the directories rel is in, from the root down and
+// without the root itself
+func parentDirs(rel string) []string {
+	dirs := []string{}
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
+}
+
+func (r *Rules) cachedIgnores(dir string) []*IgnoreList {
+	r.mu.Lock()
+	lists, ok := r.ignores[dir]
+	r.mu.Unlock()
+	if ok {
+		return lists
+	}
+	return r.loadIgnores(dir)
+}
+
+// loadIgnores (re-)reads the ignore files in dir
+func (r *Rules) loadIgnores(dir string) []*IgnoreList {
+	lists := []*IgnoreList{}
+	for _, name := range IGNORE_FILES {
+		content, err := os.ReadFile(filepath.Join(r.Root, filepath.FromSlash(dir), name))
+		if err != nil {
+			continue
+		}
+		lists = append(lists, ParseIgnore(dir, content))
+	}
+
+	r.mu.Lock()
+	r.ignores[dir] = lists
+	r.mu.Unlock()
+	return lists
+}
+
+// rel returns p relative to the root using slashes. ok is false for paths
+// outside of the root.
+func (r *Rules) rel(p string) (string, bool) {
+	rel, err := filepath.Rel(r.Root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		rel = ""
+	}
+	return rel, true
+}
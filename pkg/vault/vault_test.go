@@ -0,0 +1,137 @@
+package vault
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnoreListMatch(t *testing.T) {
+	list := ParseIgnore("", []byte(`
+# comment
+*.tmp
+build/
+/rnote
+docs/**/draft.md
+!keep.tmp
+`))
+
+	tests := []struct {
+		rel         string
+		isDir       bool
+		wantMatch   bool
+		wantIgnored bool
+	}{
+		{"a.tmp", false, true, true},
+		{"sub/b.tmp", false, true, true},
+		{"keep.tmp", false, true, false},
+		{"build", true, true, true},
+		{"build", false, false, false},
+		{"rnote", true, true, true},
+		{"sub/rnote", true, false, false},
+		{"docs/draft.md", false, true, true},
+		{"docs/a/b/draft.md", false, true, true},
+		{"notes/draft.md", false, false, false},
+		{"note.md", false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			matched, ignored := list.Match(tt.rel, tt.isDir)
+			if matched != tt.wantMatch || ignored != tt.wantIgnored {
+				t.Errorf("Match(%q) = %v, %v, want %v, %v", tt.rel, matched, ignored, tt.wantMatch, tt.wantIgnored)
+			}
+		})
+	}
+}
+
+func TestRulesNotes(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":           "node_modules/\n",
+		".graniteignore":       "rnote/\n*.draft.md\n",
+		"a.md":                 "",
+		"b.markdown":           "",
+		"c.txt":                "",
+		"d.draft.md":           "",
+		"rnote/e.md":           "",
+		"node_modules/x/f.md":  "",
+		".git/g.md":            "",
+		"sub/.graniteignore":   "!*.draft.md\nprivate.md\n",
+		"sub/h.draft.md":       "",
+		"sub/private.md":       "",
+		"sub/deeper/i.mdx":     "",
+		"templates/meeting.md": "",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules, err := NewRules(root, Config{Exclude: []string{"templates/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := rules.Notes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(root, "a.md"),
+		filepath.Join(root, "b.markdown"),
+		filepath.Join(root, "sub", "deeper", "i.mdx"),
+		filepath.Join(root, "sub", "h.draft.md"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Notes() = %v, want %v", got, want)
+	}
+
+	for _, p := range want {
+		if !rules.IsNote(p) {
+			t.Errorf("IsNote(%s) = false, want true", p)
+		}
+	}
+	for _, name := range []string{"c.txt", "d.draft.md", "rnote/e.md", "node_modules/x/f.md", ".git/g.md", "sub/private.md", "templates/meeting.md"} {
+		if rules.IsNote(filepath.Join(root, filepath.FromSlash(name))) {
+			t.Errorf("IsNote(%s) = true, want false", name)
+		}
+	}
+
+	want = []string{
+		filepath.Join(root, "sub", "deeper", "i.mdx"),
+		filepath.Join(root, "sub", "h.draft.md"),
+	}
+	// directories include every note below them, like in ignore files
+	for _, include := range [][]string{{"sub/**"}, {"sub/"}, {"sub"}, {"/sub"}} {
+		included, err := NewRules(root, Config{Include: include})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = included.Notes(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Notes() with include %v = %v, want %v", include, got, want)
+		}
+	}
+
+	included, err := NewRules(root, Config{Include: []string{"sub/", "!deeper/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = included.Notes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(root, "sub", "h.draft.md")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Notes() with negated include = %v, want %v", got, want)
+	}
+}
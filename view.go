@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+	"github.com/mrWinston/granite.nvim/pkg/tagquery"
+	"github.com/neovim/go-client/nvim"
+)
+
+// View is a named set of GetTodosArgs defined in granite.yaml. A view can
+// build on another view by naming it in view:, see mergeTodosArgs for how
+// their arguments are combined.
+type View struct {
+	Name         string `json:"name" yaml:"-"`
+	Description  string `json:"description,omitempty" yaml:"description,omitempty"`
+	GetTodosArgs `yaml:",inline"`
+}
+
+// mergeTodosArgs returns base with the arguments set in over replacing
+// those of base. Tag queries of both have to match.
+func mergeTodosArgs(base GetTodosArgs, over GetTodosArgs) GetTodosArgs {
+	merged := base
+	if len(over.States) > 0 {
+		merged.States = over.States
+	}
+	if over.Closed != nil {
+		merged.Closed = over.Closed
+	}
+	if over.Tag != "" {
+		merged.Tag = over.Tag
+	}
+	if over.TagQuery != "" {
+		merged.TagQuery = over.TagQuery
+		if base.TagQuery != "" {
+			merged.TagQuery = fmt.Sprintf("(%s) AND (%s)", base.TagQuery, over.TagQuery)
+		}
+	}
+	if over.Due != "" {
+		merged.Due = over.Due
+	}
+	if over.Assignee != "" {
+		merged.Assignee = over.Assignee
+	}
+	if over.Blocked != nil {
+		merged.Blocked = over.Blocked
+	}
+	if over.Actionable != nil {
+		merged.Actionable = over.Actionable
+	}
+	if over.CompletedFrom != "" {
+		merged.CompletedFrom = over.CompletedFrom
+	}
+	if over.CompletedTo != "" {
+		merged.CompletedTo = over.CompletedTo
+	}
+	if over.Sort != "" {
+		merged.Sort = over.Sort
+	}
+	if over.GroupBy != "" {
+		merged.GroupBy = over.GroupBy
+	}
+	if over.Limit > 0 {
+		merged.Limit = over.Limit
+	}
+	merged.View = over.View
+	return merged
+}
+
+// resolveView returns the arguments of the view called name merged with
+// those of the views it builds on. path are the views referencing it, to
+// detect cycles.
+func (g *Granite) resolveView(name string, path []string) (GetTodosArgs, error) {
+	if slices.Contains(path, name) {
+		return GetTodosArgs{}, fmt.Errorf("Views reference each other: %s", strings.Join(append(path, name), " -> "))
+	}
+	view, ok := g.Views[name]
+	if !ok {
+		return GetTodosArgs{}, fmt.Errorf("Unknown view '%s'", name)
+	}
+	args := view.GetTodosArgs
+	if args.View != "" {
+		base, err := g.resolveView(args.View, append(path, name))
+		if err != nil {
+			return GetTodosArgs{}, err
+		}
+		args = mergeTodosArgs(base, args)
+	}
+	args.View = ""
+	return args, nil
+}
+
+// checkViews resolves all views and checks their states, queries, sort and
+// group keys, so mistakes in granite.yaml show up on Init
+func (g *Granite) checkViews() error {
+	names := []string{}
+	for name := range g.Views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := g.queryEnv(time.Now())
+	for _, name := range names {
+		args, err := g.resolveView(name, nil)
+		if err != nil {
+			return err
+		}
+		for _, state := range args.States {
+			if _, err := g.States.Resolve(state); err != nil {
+				return fmt.Errorf("View '%s': %w", name, err)
+			}
+		}
+		if args.TagQuery != "" {
+			if _, err := tagquery.ParseWith(args.TagQuery, env); err != nil {
+				return fmt.Errorf("View '%s': %w", name, err)
+			}
+		}
+		if args.Tag != "" {
+			if _, err := tagquery.ParsePattern(args.Tag); err != nil {
+				return fmt.Errorf("View '%s': %w", name, err)
+			}
+		}
+		if args.Sort != "" {
+			if err := models.SortTodos(nil, args.Sort, g.States); err != nil {
+				return fmt.Errorf("View '%s': %w", name, err)
+			}
+		}
+		if args.GroupBy != "" {
+			if _, err := models.GroupTodos(nil, args.GroupBy, "", ""); err != nil {
+				return fmt.Errorf("View '%s': %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetViews returns the views of granite.yaml as json encoded View list
+// sorted by name. The arguments of each view are merged with those of the
+// views it builds on, view: still names the view it builds on.
+func (g *Granite) GetViews(v *nvim.Nvim) (string, error) {
+	views := []*View{}
+	for name, view := range g.Views {
+		args, err := g.resolveView(name, nil)
+		if err != nil {
+			g.logger.Errorf("Invalid view: %v", err)
+			return "", fmt.Errorf("Invalid view: %w", err)
+		}
+		args.View = view.View
+		views = append(views, &View{Name: name, Description: view.Description, GetTodosArgs: args})
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+
+	rawJson, err := json.Marshal(views)
+	return string(rawJson), err
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mrWinston/granite.nvim/pkg/models"
+)
+
+func TestMergeTodosArgs(t *testing.T) {
+	yes, no := true, false
+	base := GetTodosArgs{
+		View:     "base",
+		States:   []string{"OPEN"},
+		Closed:   &no,
+		TagQuery: "#work",
+		Assignee: "alice",
+		Sort:     "urgency",
+		Limit:    10,
+	}
+	over := GetTodosArgs{
+		View:     "over",
+		States:   []string{"IN_PROGRESS", "DONE"},
+		Closed:   &yes,
+		TagQuery: "due<today+7d OR @bob",
+		Sort:     "due",
+	}
+
+	got := mergeTodosArgs(base, over)
+	want := GetTodosArgs{
+		View:     "over",
+		States:   []string{"IN_PROGRESS", "DONE"},
+		Closed:   &yes,
+		TagQuery: "(#work) AND (due<today+7d OR @bob)",
+		Assignee: "alice",
+		Sort:     "due",
+		Limit:    10,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeTodosArgs() = %+v, want %+v", got, want)
+	}
+
+	// a query on one side only is kept as it is
+	if got := mergeTodosArgs(GetTodosArgs{TagQuery: "#work"}, GetTodosArgs{}); got.TagQuery != "#work" {
+		t.Errorf("mergeTodosArgs() TagQuery = %q, want %q", got.TagQuery, "#work")
+	}
+	if got := mergeTodosArgs(GetTodosArgs{}, GetTodosArgs{TagQuery: "#home"}); got.TagQuery != "#home" {
+		t.Errorf("mergeTodosArgs() TagQuery = %q, want %q", got.TagQuery, "#home")
+	}
+}
+
+func TestResolveView(t *testing.T) {
+	g := newTestGranite(t, nil)
+	g.Views = map[string]*View{
+		"work":   {GetTodosArgs: GetTodosArgs{TagQuery: "#work", Sort: "urgency", Limit: 20}},
+		"week":   {GetTodosArgs: GetTodosArgs{View: "work", TagQuery: "due<today+7d", Limit: 5}},
+		"mine":   {GetTodosArgs: GetTodosArgs{View: "week", Assignee: "alice", Sort: "due"}},
+		"first":  {GetTodosArgs: GetTodosArgs{View: "second"}},
+		"second": {GetTodosArgs: GetTodosArgs{View: "third"}},
+		"third":  {GetTodosArgs: GetTodosArgs{View: "first"}},
+		"self":   {GetTodosArgs: GetTodosArgs{View: "self"}},
+		"broken": {GetTodosArgs: GetTodosArgs{View: "missing"}},
+	}
+
+	got, err := g.resolveView("mine", nil)
+	if err != nil {
+		t.Fatalf("resolveView() error = %v", err)
+	}
+	want := GetTodosArgs{
+		TagQuery: "(#work) AND (due<today+7d)",
+		Assignee: "alice",
+		Sort:     "due",
+		Limit:    5,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveView() = %+v, want %+v", got, want)
+	}
+
+	failures := map[string]string{
+		"first":   "first -> second -> third -> first",
+		"self":    "self -> self",
+		"broken":  "Unknown view 'missing'",
+		"missing": "Unknown view 'missing'",
+	}
+	for name, want := range failures {
+		_, err := g.resolveView(name, nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("resolveView(%q) error = %v, want %q", name, err, want)
+		}
+	}
+}
+
+func TestCheckViews(t *testing.T) {
+	tests := map[string]struct {
+		views map[string]*View
+		want  string
+	}{
+		"valid": {
+			views: map[string]*View{
+				"work":  {GetTodosArgs: GetTodosArgs{States: []string{"open", "[/]"}, TagQuery: "#work", Tag: "#project/*"}},
+				"board": {GetTodosArgs: GetTodosArgs{View: "work", Sort: "due", GroupBy: "state"}},
+			},
+		},
+		"unknown state": {
+			views: map[string]*View{"work": {GetTodosArgs: GetTodosArgs{States: []string{"WAITING"}}}},
+			want:  "View 'work'",
+		},
+		"invalid query": {
+			views: map[string]*View{"work": {GetTodosArgs: GetTodosArgs{TagQuery: "#work AND"}}},
+			want:  "View 'work'",
+		},
+		"invalid sort key": {
+			views: map[string]*View{"work": {GetTodosArgs: GetTodosArgs{Sort: "colour"}}},
+			want:  "View 'work'",
+		},
+		"invalid group key": {
+			views: map[string]*View{"work": {GetTodosArgs: GetTodosArgs{GroupBy: "colour"}}},
+			want:  "View 'work'",
+		},
+		"inherited mistakes": {
+			views: map[string]*View{
+				"base":  {GetTodosArgs: GetTodosArgs{Sort: "colour"}},
+				"child": {GetTodosArgs: GetTodosArgs{View: "base"}},
+			},
+			want: "View 'base'",
+		},
+		"cycle": {
+			views: map[string]*View{
+				"a": {GetTodosArgs: GetTodosArgs{View: "b"}},
+				"b": {GetTodosArgs: GetTodosArgs{View: "a"}},
+			},
+			want: "a -> b -> a",
+		},
+		"unknown view": {
+			views: map[string]*View{"work": {GetTodosArgs: GetTodosArgs{View: "missing"}}},
+			want:  "Unknown view 'missing'",
+		},
+	}
+	for name, tt := range tests {
+		g := newTestGranite(t, nil)
+		g.Views = tt.views
+		err := g.checkViews()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: checkViews() error = %v", name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: checkViews() error = %v, want %q", name, err, tt.want)
+		}
+	}
+}
+
+func TestGetTodosViewTagAndQuery(t *testing.T) {
+	g := newTestGranite(t, map[string]string{
+		"note.md": strings.Join([]string{
+			"- [ ] #task #work #project/alpha a",
+			"- [ ] #task #work #project/beta b",
+			"- [ ] #task #home #project/alpha c",
+			"",
+		}, "\n"),
+	})
+	g.Views = map[string]*View{
+		"work":  {GetTodosArgs: GetTodosArgs{TagQuery: "#work"}},
+		"alpha": {GetTodosArgs: GetTodosArgs{View: "work", Tag: "#project/alpha"}},
+	}
+
+	raw, err := g.GetTodos(nil, []string{`{"view": "alpha"}`})
+	if err != nil {
+		t.Fatalf("GetTodos() error = %v", err)
+	}
+	todos := []*models.Todo{}
+	if err := json.Unmarshal([]byte(raw), &todos); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, todo := range todos {
+		got = append(got, todo.Text)
+	}
+	if want := []string{"[ ] #task #work #project/alpha a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTodos() = %q, want %q", got, want)
+	}
+}